@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/config"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/migrate"
+)
+
+const (
+	migrateUsage = "usage: chirpy migrate up|down|status|redo"
+	configUsage  = "usage: chirpy config print"
+	adminUsage   = "usage: chirpy admin grant <email> <role>"
+)
+
+// runCommand dispatches the chirpy subcommands given on the command line.
+func runCommand(cfg config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(cfg, args[1:])
+	case "config":
+		return runConfig(cfg, args[1:])
+	case "admin":
+		return runAdmin(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func runMigrate(cfg config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	if cfg.Database.URL == "" {
+		return errors.New("migrate needs a database url")
+	}
+
+	db, err := sql.Open("postgres", cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = migrate.Run(context.Background(), db, args[0], os.Stdout)
+	if errors.Is(err, migrate.ErrUnknownCommand) {
+		return errors.New(migrateUsage)
+	}
+	return err
+}
+
+func runConfig(cfg config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+
+	return cfg.Print(os.Stdout)
+}
+
+// runAdmin changes a user's role. The new role is in the user's tokens
+// from their next login or refresh.
+func runAdmin(cfg config.Config, args []string) error {
+	if len(args) != 3 || args[0] != "grant" {
+		return errors.New(adminUsage)
+	}
+
+	role, err := auth.ParseRole(args[2])
+	if err != nil {
+		return err
+	}
+
+	if cfg.Database.URL == "" {
+		return errors.New("admin needs a database url")
+	}
+
+	db, err := sql.Open("postgres", cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := database.New(db).SetUserRole(context.Background(), database.SetUserRoleParams{
+		Email: args[1],
+		Role:  string(role),
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no user with email %q", args[1])
+	}
+
+	fmt.Fprintf(os.Stdout, "%s is now %s\n", args[1], role)
+	return nil
+}
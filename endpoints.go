@@ -1,24 +1,30 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"slices"
 	"strings"
 	"time"
 
 	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
 	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/entities"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/events"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/metrics"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
 
-type chirpError struct {
-	Error string `json:"error"`
-}
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = time.Hour * 24 * 60
+	maxChirpLength  = 140
+)
 
 type login struct {
 	Password string `json:"password"`
@@ -26,23 +32,98 @@ type login struct {
 }
 
 type UserResponse struct {
-	ID           uuid.UUID `json:"id"`
-	Email        string    `json:"email"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
+	ID            uuid.UUID `json:"id"`
+	Email         string    `json:"email"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Handle        string    `json:"handle,omitempty"`
+	Role          string    `json:"role"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	TwoFactor     bool      `json:"two_factor_enabled"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+}
+
+// ChirpResponse is a chirp as the API returns it. LikedByMe and
+// RechirpedByMe are only set when the caller is authenticated. Entities
+// locate the hashtags and mentions in Body.
+type ChirpResponse struct {
+	ID            uuid.UUID         `json:"id"`
+	Body          string            `json:"body"`
+	UserID        uuid.UUID         `json:"user_id"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Edited        bool              `json:"edited"`
+	RevisionCount int32             `json:"revision_count"`
+	InReplyTo     uuid.NullUUID     `json:"in_reply_to"`
+	ReplyCount    int32             `json:"reply_count"`
+	Deleted       bool              `json:"deleted"`
+	Hidden        bool              `json:"hidden"`
+	LikeCount     int32             `json:"like_count"`
+	RechirpCount  int32             `json:"rechirp_count"`
+	LikedByMe     *bool             `json:"liked_by_me,omitempty"`
+	RechirpedByMe *bool             `json:"rechirped_by_me,omitempty"`
+	Entities      []entities.Entity `json:"entities"`
+}
+
+// ChirpRevisionResponse is a body a chirp had before an edit. CreatedAt is
+// when that body was written and ReplacedAt when the edit replaced it.
+type ChirpRevisionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+type refreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 func userToResponse(u database.User, token string, refresh_token string) UserResponse {
 	return UserResponse{
-		ID:           u.ID,
-		Email:        u.Email,
-		CreatedAt:    u.CreatedAt,
-		UpdatedAt:    u.UpdatedAt,
-		Token:        token,
-		RefreshToken: refresh_token,
+		ID:            u.ID,
+		Email:         u.Email,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+		IsChirpyRed:   u.IsChirpyRed,
+		Handle:        u.Handle.String,
+		Role:          u.Role,
+		EmailVerified: u.EmailVerifiedAt.Valid,
+		PendingEmail:  u.PendingEmail.String,
+		TwoFactor:     u.TotpEnabledAt.Valid,
+		Token:         token,
+		RefreshToken:  refresh_token,
+	}
+}
+
+func chirpToResponse(c database.Chirp) ChirpResponse {
+	return ChirpResponse{
+		ID:            c.ID,
+		Body:          c.Body,
+		UserID:        c.UserID,
+		CreatedAt:     c.CreatedAt,
+		UpdatedAt:     c.UpdatedAt,
+		Edited:        c.RevisionCount > 0,
+		RevisionCount: c.RevisionCount,
+		InReplyTo:     c.InReplyTo,
+		ReplyCount:    c.ReplyCount,
+		Deleted:       c.DeletedAt.Valid,
+		Hidden:        c.HiddenAt.Valid,
+		LikeCount:     c.LikeCount,
+		RechirpCount:  c.RechirpCount,
+		Entities:      entities.Parse(c.Body),
+	}
+}
+
+func chirpsToResponse(chirps []database.Chirp) []ChirpResponse {
+	res := make([]ChirpResponse, 0, len(chirps))
+	for _, c := range chirps {
+		res = append(res, chirpToResponse(c))
 	}
+	return res
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -57,7 +138,7 @@ func readinessEndpoint(w http.ResponseWriter, r *http.Request) {
 
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error reading body: %v", err)
+		requestLogger(r).Error("reading body", "err", err)
 		http.Error(w, "can't read body", http.StatusInternalServerError)
 		return
 	}
@@ -70,6 +151,13 @@ func readinessEndpoint(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) hitsEndpoint(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
+	if wantsPrometheus(r) {
+		w.Header().Set("Content-Type", metrics.ContentType)
+		w.WriteHeader(http.StatusOK)
+		cfg.metrics.registry.WriteText(w)
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	hitsValue := cfg.fileserverHits.Load()
@@ -79,25 +167,25 @@ func (cfg *apiConfig) hitsEndpoint(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) resetEndpoint(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if cfg.platform != "dev" {
-		w.WriteHeader(http.StatusForbidden)
+		respondWithError(w, errForbidden)
 		return
 	}
 
 	cfg.fileserverHits.Store(0)
 	err := cfg.queries.DeleteUsers(r.Context())
 	if err != nil {
-		log.Printf("Error deleting user: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		requestLogger(r).Error("deleting user", "err", err)
+		respondWithError(w, databaseError(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-func respondWithError(w http.ResponseWriter, status int, msg string) {
-	body, err := json.Marshal(chirpError{Error: msg})
+func respondWithJSON(w http.ResponseWriter, status int, vals any) {
+	body, err := json.Marshal(vals)
 	if err != nil {
-		log.Printf("Json marshal failed: %v", err)
+		slog.Error("json marshal failed", "err", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -107,64 +195,77 @@ func respondWithError(w http.ResponseWriter, status int, msg string) {
 	w.Write(body)
 }
 
-func respondWithJSON(w http.ResponseWriter, status int, vals any) {
-	body, err := json.Marshal(vals)
-	if err != nil {
-		log.Printf("Json marshal failed: %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+// validateCredentials reports the fields of a signup or account update that
+// can't be stored.
+func validateCredentials(l login) []fieldError {
+	var fields []fieldError
+	if strings.TrimSpace(l.Email) == "" {
+		fields = append(fields, fieldError{Field: "email", Code: "required", Detail: "Email is required"})
 	}
-
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(status)
-	w.Write(body)
+	if l.Password == "" {
+		fields = append(fields, fieldError{Field: "password", Code: "required", Detail: "Password is required"})
+	}
+	return fields
 }
 
-func cleanString(s string) (cleanS string) {
-	var badWords = []string{"kerfuffle", "sharbert", "fornax"}
-	words := strings.Fields(s)
-	for i, word := range words {
-		if slices.Contains(badWords, word) {
-			words[i] = "****"
-		}
+// validateHandle normalises an optional handle; an empty one is null.
+func validateHandle(handle string) (sql.NullString, []fieldError) {
+	if handle == "" {
+		return sql.NullString{}, nil
 	}
 
-	return strings.Join(words, " ")
+	normalized, ok := entities.NormalizeHandle(handle)
+	if !ok {
+		return sql.NullString{}, []fieldError{{Field: "handle", Code: "invalid", Detail: "Handles are 1 to 15 letters, digits or underscores"}}
+	}
+	return sql.NullString{String: normalized, Valid: true}, nil
 }
 
 func (cfg *apiConfig) create_userEndpoint(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	type create_user struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		login
+		Handle string `json:"handle"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	var cu create_user
 	if err := decoder.Decode(&cu); err != nil {
-		log.Printf("Error decoding request body: %s", err)
-		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	handle, handleFields := validateHandle(cu.Handle)
+	if fields := append(validateCredentials(cu.login), handleFields...); len(fields) > 0 {
+		respondWithError(w, errValidation.withFields(fields...))
 		return
 	}
 
 	hashed_password, err := auth.HashPassword(cu.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		requestLogger(r).Info("hashing password", "err", err)
+		respondWithError(w, errValidation.withFields(fieldError{Field: "password", Code: "invalid", Detail: err.Error()}))
 		return
 	}
 
 	create_user_params := database.CreateUserParams{
 		Email:          cu.Email,
 		HashedPassword: hashed_password,
+		Handle:         handle,
 	}
 
 	user, err := cfg.queries.CreateUser(r.Context(), create_user_params)
 	if err != nil {
-		log.Printf("Error creating user: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		requestLogger(r).Error("creating user", "err", err)
+		respondWithError(w, databaseError(err))
 		return
 	}
+	setRequestUser(r, user.ID)
+
+	// The account is usable right away; if the mail fails the user can ask
+	// for another link.
+	cfg.sendEmailVerificationLater(r, user.ID, user.Email)
 
 	respondWithJSON(w, http.StatusCreated, user)
 }
@@ -173,185 +274,378 @@ func (cfg *apiConfig) create_chirpEndpoint(w http.ResponseWriter, r *http.Reques
 	defer r.Body.Close()
 
 	type payload struct {
-		Body   string    `json:"body"`
-		UserID uuid.UUID `json:"user_id"`
+		Body      string        `json:"body"`
+		UserID    uuid.UUID     `json:"user_id"`
+		InReplyTo uuid.NullUUID `json:"in_reply_to"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	var postVal payload
 	if err := decoder.Decode(&postVal); err != nil {
-		log.Printf("Error decoding request body: %s", err)
-		respondWithError(w, http.StatusBadRequest, "Something went wrong")
-		return
-	}
-
-	if len(postVal.Body) > 140 {
-		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
 		return
 	}
 
-	postVal.Body = cleanString(postVal.Body)
-
 	user_secret, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Error while get bearer token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Something went wrong")
+		requestLogger(r).Info("reading bearer token", "err", err)
+		respondWithError(w, errTokenMissing)
 		return
 	}
 
 	user_id, err := auth.ValidateJWT(user_secret, cfg.secret)
 	if err != nil || user_id != postVal.UserID {
-		log.Printf("Error while validating jwt: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "Something went wrong")
+		requestLogger(r).Info("validating jwt", "err", err)
+		respondWithError(w, errTokenInvalid)
+		return
+	}
+	setRequestUser(r, user_id)
+
+	if !cfg.canPost(w, r, user_id) {
+		return
+	}
+
+	moderated, ok := cfg.moderateChirp(w, r, postVal.Body)
+	if !ok {
 		return
 	}
 
+	if postVal.InReplyTo.Valid {
+		parent, err := cfg.queries.GetChirp(r.Context(), postVal.InReplyTo.UUID)
+		if err != nil || parent.DeletedAt.Valid {
+			requestLogger(r).Info("getting parent chirp", "err", err)
+			respondWithError(w, errValidation.withFields(fieldError{Field: "in_reply_to", Code: "not_found", Detail: "Chirp was not found"}))
+			return
+		}
+	}
+
 	chirp, err := cfg.queries.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   postVal.Body,
-		UserID: postVal.UserID,
+		InReplyTo: postVal.InReplyTo,
+		Body:      moderated.Body,
+		UserID:    postVal.UserID,
 	})
 	if err != nil {
-		log.Printf("Error creating chirp: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		requestLogger(r).Error("creating chirp", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	if err := cfg.saveChirpEntities(r.Context(), chirp); err != nil {
+		requestLogger(r).Error("saving chirp entities", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	cfg.flagChirp(r, chirp.ID, moderated)
+
+	cfg.publishChirpEvent(events.ChirpCreated, chirp.UserID, chirpToResponse(chirp))
+
+	res := chirpToResponse(chirp)
+	if err := cfg.setViewerState(r.Context(), uuid.NullUUID{UUID: user_id, Valid: true}, &res); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, chirp)
+	respondWithJSON(w, http.StatusCreated, res)
 }
 
 func (cfg *apiConfig) get_chirpsEndpoint(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	chirps, err := cfg.queries.GetAllChirps(r.Context())
+	viewer, ok := cfg.viewer(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	page, err := parsePageRequest(query)
 	if err != nil {
-		log.Printf("Error getting chirps: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, chirps)
+	var authorID uuid.NullUUID
+	if a := query.Get("author_id"); a != "" {
+		id, err := uuid.Parse(a)
+		if err != nil {
+			requestLogger(r).Info("transforming author uuid", "err", err)
+			respondWithError(w, errInvalidQuery.withDetail("Invalid author_id"))
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+
+	var chirps []database.Chirp
+	switch query.Get("sort") {
+	case "", "asc":
+		chirps, err = cfg.queries.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:        authorID,
+			ViewerID:        viewer,
+			IncludeHidden:   cfg.canModerate(r),
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageSize:        page.Limit,
+		})
+	case "desc":
+		chirps, err = cfg.queries.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:        authorID,
+			ViewerID:        viewer,
+			IncludeHidden:   cfg.canModerate(r),
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageSize:        page.Limit,
+		})
+	default:
+		respondWithError(w, errInvalidQuery.withDetail("sort must be asc or desc"))
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("getting chirps", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	res := chirpsToResponse(chirps)
+	if err := cfg.setViewerState(r.Context(), viewer, chirpRefs(res)...); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	if len(chirps) > 0 {
+		last := chirps[len(chirps)-1]
+		setNextLink(w, r, page, len(chirps), pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
 }
 
 func (cfg *apiConfig) get_chirpEndpoint(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	id := r.PathValue("chirpID")
 
+	viewer, ok := cfg.viewer(w, r)
+	if !ok {
+		return
+	}
+
 	id_uuid, err := uuid.Parse(id)
 	if err != nil {
-		log.Printf("Error transforming uuid: %s", err)
-		respondWithError(w, http.StatusNotFound, "Invalid uuid")
+		requestLogger(r).Info("transforming uuid", "err", err)
+		respondWithError(w, errChirpNotFound)
 		return
 	}
 
 	chirp, err := cfg.queries.GetChirp(r.Context(), id_uuid)
 	if err != nil {
-		log.Printf("Error getting chirp from uuid: %s", err)
-		respondWithError(w, http.StatusNotFound, "Invalid uuid")
+		requestLogger(r).Info("getting chirp from uuid", "err", err)
+		respondWithError(w, errChirpNotFound)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, chirp)
+	if !cfg.canView(r, chirp) {
+		requestLogger(r).Info("chirp is hidden", "chirp_id", chirp.ID)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	res := chirpToResponse(chirp)
+	if err := cfg.setViewerState(r.Context(), viewer, &res); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
 }
 
 func (cfg *apiConfig) loginEndpoint(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
+	type payload struct {
+		login
+		DeviceName string `json:"device_name"`
+	}
+
 	decoder := json.NewDecoder(r.Body)
-	var l login
+	var l payload
 	if err := decoder.Decode(&l); err != nil {
-		log.Printf("Error decoding request body: %s", err)
-		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	deviceName, fields := validateDeviceName(l.DeviceName)
+	if len(fields) > 0 {
+		respondWithError(w, errValidation.withFields(fields...))
+		return
+	}
+
+	if !cfg.checkLoginThrottle(w, r, l.Email) {
 		return
 	}
 
 	user, err := cfg.queries.GetUserWithEmail(r.Context(), l.Email)
 	if err != nil {
-		log.Printf("Error getting user: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrent password or email")
+		requestLogger(r).Info("getting user", "err", err)
+		auth.CheckDummyPasswordHash(l.Password)
+		cfg.recordLoginFailure(r, l.Email)
+		respondWithError(w, errInvalidCredentials)
 		return
 	}
 
 	match, err := auth.CheckPasswordHash(l.Password, user.HashedPassword)
 	if err != nil {
-		log.Printf("Error checking password: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrent password or email")
+		requestLogger(r).Info("checking password", "err", err)
+		cfg.recordLoginFailure(r, l.Email)
+		respondWithError(w, errInvalidCredentials)
 		return
 	}
 
 	if match {
-		jwt, err := auth.MakeJWT(user.ID, cfg.secret, time.Hour)
-		if err != nil {
-			log.Printf("Error making jwt: %s", err)
-			respondWithError(w, http.StatusUnauthorized, "Incorrent password or email")
-			return
-		}
+		setRequestUser(r, user.ID)
 
-		token, err := auth.MakeRefreshToken()
-		if err != nil {
-			log.Printf("Error making refresh_token: %s", err)
-			respondWithError(w, http.StatusUnauthorized, "Incorrent password or email")
+		if user.SuspendedAt.Valid {
+			requestLogger(r).Info("user is suspended")
+			respondWithError(w, errAccountSuspended)
 			return
 		}
 
-		_, err = cfg.queries.CreateToken(r.Context(), database.CreateTokenParams{
-			Token:     token,
-			UserID:    user.ID,
-			ExpiresAt: time.Now().Add(time.Hour * 24 * 60),
-		})
-
-		if err != nil {
-			log.Printf("Error while inserting refresh_token into database: %s", err)
-			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		if user.TotpEnabledAt.Valid {
+			cfg.challengeSecondFactor(w, r, user)
 			return
 		}
 
-		respondWithJSON(w, http.StatusOK, userToResponse(user, jwt, token))
+		cfg.startSession(w, r, user, deviceName)
 	} else {
-		respondWithError(w, http.StatusUnauthorized, "Incorrent password or email")
+		cfg.recordLoginFailure(r, l.Email)
+		respondWithError(w, errInvalidCredentials)
 	}
 }
 
+// startSession responds to a completed login with an access token and the
+// first refresh token of a new family. The family is the session.
+func (cfg *apiConfig) startSession(w http.ResponseWriter, r *http.Request, user database.User, deviceName string) {
+	sessionID := uuid.New()
+
+	jwt, err := auth.MakeJWT(user.ID, cfg.secret, accessTokenTTL, auth.WithRole(auth.Role(user.Role)), auth.WithSession(sessionID))
+	if err != nil {
+		requestLogger(r).Error("making jwt", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	token, err := cfg.createRefreshToken(r, user.ID, sessionID, deviceName)
+	if err != nil {
+		requestLogger(r).Error("inserting refresh_token into database", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	cfg.clearLoginFailures(r, user.Email)
+
+	respondWithJSON(w, http.StatusOK, userToResponse(user, jwt, token))
+}
+
+// refreshEndpoint exchanges a refresh token for a new access token and a
+// rotated refresh token. Every rotation stays in the token family created at
+// login, so a revoked token showing up again means it leaked and the whole
+// family is revoked.
 func (cfg *apiConfig) refreshEndpoint(w http.ResponseWriter, r *http.Request) {
 	user_token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Error getting token from header: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("getting token from header", "err", err)
+		respondWithError(w, errTokenMissing)
+		return
+	}
+
+	token, err := cfg.queries.GetToken(r.Context(), user_token)
+	if err != nil {
+		requestLogger(r).Info("getting token from database", "err", err)
+		respondWithError(w, errTokenInvalid)
 		return
 	}
+	setRequestUser(r, token.UserID)
 
-	valid, token := cfg.isTokenValid(user_token, w, r)
-	if !valid {
+	if token.RevokedAt.Valid {
+		requestLogger(r).Warn("revoked refresh token reused, revoking family", "family_id", token.FamilyID)
+		cfg.revokeTokenFamily(w, r, token.FamilyID)
 		return
 	}
 
-	user_id, err := cfg.queries.GetUserForToken(r.Context(), token.Token)
-	if err != nil || !user_id.Valid {
-		log.Printf("Error geting user for token: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+	if time.Now().After(token.ExpiresAt) {
+		requestLogger(r).Info("token is expired")
+		respondWithError(w, errTokenExpired)
 		return
 	}
 
-	new_token, err := auth.MakeRefreshToken()
+	new_token, err := cfg.createRefreshToken(r, token.UserID, token.FamilyID, token.DeviceName)
 	if err != nil {
-		log.Printf("Error creating user token: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		requestLogger(r).Error("inserting refresh_token into database", "err", err)
+		respondWithError(w, errInternal)
 		return
 	}
 
-	_, err = cfg.queries.CreateToken(r.Context(), database.CreateTokenParams{
-		Token:     new_token,
-		UserID:    user_id.UUID,
-		ExpiresAt: time.Now().Add(time.Hour),
+	rotated, err := cfg.queries.RotateToken(r.Context(), database.RotateTokenParams{
+		Token:      token.Token,
+		ReplacedBy: sql.NullString{String: new_token, Valid: true},
 	})
+	if err != nil {
+		requestLogger(r).Error("rotating refresh_token", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
 
-	w.WriteHeader(http.StatusNoContent)
+	// Another request rotated the same token first.
+	if rotated == 0 {
+		requestLogger(r).Warn("refresh token rotated concurrently, revoking family", "family_id", token.FamilyID)
+		cfg.revokeTokenFamily(w, r, token.FamilyID)
+		return
+	}
+
+	// The role is read again so a grant takes effect on the next refresh.
+	user, err := cfg.queries.GetUserWithId(r.Context(), token.UserID)
+	if err != nil {
+		requestLogger(r).Error("getting user", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	jwt, err := auth.MakeJWT(user.ID, cfg.secret, accessTokenTTL, auth.WithRole(auth.Role(user.Role)), auth.WithSession(token.FamilyID))
+	if err != nil {
+		requestLogger(r).Error("making jwt", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, refreshResponse{
+		Token:        jwt,
+		RefreshToken: new_token,
+	})
+}
+
+func (cfg *apiConfig) revokeTokenFamily(w http.ResponseWriter, r *http.Request, familyID uuid.UUID) {
+	err := cfg.queries.RevokeTokenFamily(r.Context(), familyID)
+	if err != nil {
+		requestLogger(r).Error("revoking token family", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	respondWithError(w, errTokenRevoked)
 }
 
 func (cfg *apiConfig) revokeEndpoint(w http.ResponseWriter, r *http.Request) {
 	user_token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Error getting token from header: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("getting token from header", "err", err)
+		respondWithError(w, errTokenMissing)
 		return
 	}
 
@@ -362,8 +656,8 @@ func (cfg *apiConfig) revokeEndpoint(w http.ResponseWriter, r *http.Request) {
 
 	err = cfg.queries.RevokeToken(r.Context(), token.Token)
 	if err != nil {
-		log.Printf("Error revoking token: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		requestLogger(r).Error("revoking token", "err", err)
+		respondWithError(w, errInternal)
 		return
 	}
 
@@ -373,16 +667,16 @@ func (cfg *apiConfig) revokeEndpoint(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) isTokenValid(token string, w http.ResponseWriter, r *http.Request) (bool, database.GetTokenRow) {
 	databaseToken, err := cfg.queries.GetToken(r.Context(), token)
 	if err != nil {
-		log.Printf("Error getting token from database: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("getting token from database", "err", err)
+		respondWithError(w, errTokenInvalid)
 		return false, database.GetTokenRow{}
 	} else if time.Now().After(databaseToken.ExpiresAt) {
-		log.Print("Token is expired")
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("token is expired")
+		respondWithError(w, errTokenExpired)
 		return false, database.GetTokenRow{}
 	} else if databaseToken.RevokedAt.Valid && time.Now().After(databaseToken.RevokedAt.Time) {
-		log.Print("Token is revoked")
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("token is revoked")
+		respondWithError(w, errTokenRevoked)
 		return false, database.GetTokenRow{}
 
 	}
@@ -390,50 +684,183 @@ func (cfg *apiConfig) isTokenValid(token string, w http.ResponseWriter, r *http.
 	return true, databaseToken
 }
 
+// authenticate validates the access token in the Authorization header and
+// returns its subject. On failure the error response has already been sent.
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	claims, ok := cfg.accessClaims(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return claims.UserID, true
+}
+
+// accessClaims validates the bearer access token. On failure the error
+// response has already been sent.
+func (cfg *apiConfig) accessClaims(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	bearer, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		requestLogger(r).Info("reading bearer token", "err", err)
+		respondWithError(w, errTokenMissing)
+		return nil, false
+	}
+
+	claims, err := auth.ParseJWT(bearer, cfg.secret)
+	if err != nil {
+		requestLogger(r).Info("validating jwt", "err", err)
+		respondWithError(w, errTokenInvalid)
+		return nil, false
+	}
+	setRequestUser(r, claims.UserID)
+
+	return claims, true
+}
+
+// requireRole only lets requests through when their access token carries
+// the role or one that includes it.
+func (cfg *apiConfig) requireRole(role auth.Role, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := cfg.accessClaims(w, r)
+		if !ok {
+			return
+		}
+
+		if !claims.Role.Includes(role) {
+			requestLogger(r).Info("role not allowed", "role", claims.Role, "required", role)
+			respondWithError(w, errInsufficientRole)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// canModerate reports whether the caller is a moderator or admin. It never
+// sends a response, so endpoints open to everyone can use it to show
+// moderators more.
+func (cfg *apiConfig) canModerate(r *http.Request) bool {
+	bearer, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return false
+	}
+	claims, err := auth.ParseJWT(bearer, cfg.secret)
+	return err == nil && claims.Role.Includes(auth.RoleModerator)
+}
+
+// canView reports whether the caller may see the chirp. Hidden chirps are
+// only visible to their author and to moderators. Like canModerate it never
+// sends a response.
+func (cfg *apiConfig) canView(r *http.Request, chirp database.Chirp) bool {
+	if !chirp.HiddenAt.Valid {
+		return true
+	}
+
+	bearer, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return false
+	}
+	claims, err := auth.ParseJWT(bearer, cfg.secret)
+	return err == nil && (claims.UserID == chirp.UserID || claims.Role.Includes(auth.RoleModerator))
+}
+
 func (cfg *apiConfig) update_passwordEndpoint(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	user_token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Error getting token from header: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("getting token from header", "err", err)
+		respondWithError(w, errTokenMissing)
 		return
 	}
 
-	val, _ := cfg.isTokenValid(user_token, w, r)
+	val, token := cfg.isTokenValid(user_token, w, r)
 	if !val {
 		return
 	}
 
 	user_id, err := cfg.queries.GetUserForToken(r.Context(), user_token)
 	if err != nil || !user_id.Valid {
-		log.Printf("Error getting user for token: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("getting user for token", "err", err)
+		respondWithError(w, errTokenInvalid)
 		return
 	}
+	setRequestUser(r, user_id.UUID)
+
+	// RevokeOtherSessions signs out every device except the one whose
+	// refresh token made this request.
+	type payload struct {
+		login
+		Handle              string `json:"handle"`
+		RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+	}
 
 	decoder := json.NewDecoder(r.Body)
-	var l login
+	var l payload
 	if err := decoder.Decode(&l); err != nil {
-		log.Printf("Error decoding login body: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Invalid login")
+		requestLogger(r).Info("decoding login body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	handle, handleFields := validateHandle(l.Handle)
+	if fields := append(validateCredentials(l.login), handleFields...); len(fields) > 0 {
+		respondWithError(w, errValidation.withFields(fields...))
 		return
 	}
 
 	hashed_password, err := auth.HashPassword(l.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		requestLogger(r).Info("hashing password", "err", err)
+		respondWithError(w, errValidation.withFields(fieldError{Field: "password", Code: "invalid", Detail: err.Error()}))
 		return
 	}
 
-	user, err := cfg.queries.UpdateUserEmailAndPassword(r.Context(), database.UpdateUserEmailAndPasswordParams{
-		ID:             user_id.UUID,
-		Email:          l.Email,
+	current, err := cfg.queries.GetUserWithId(r.Context(), user_id.UUID)
+	if err != nil {
+		requestLogger(r).Error("getting user", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	// A new address waits as pending until a link sent to it is opened.
+	// Asking for the current address again cancels a pending change.
+	var pending sql.NullString
+	if l.Email != current.Email {
+		if other, err := cfg.queries.GetUserWithEmail(r.Context(), l.Email); err == nil && other.ID != current.ID {
+			respondWithError(w, errEmailTaken)
+			return
+		}
+		pending = sql.NullString{String: l.Email, Valid: true}
+	}
+
+	user, err := cfg.queries.UpdateUserAccount(r.Context(), database.UpdateUserAccountParams{
+		ID:             current.ID,
 		HashedPassword: hashed_password,
+		Handle:         handle,
+		PendingEmail:   pending,
 	})
+	if err != nil {
+		requestLogger(r).Error("updating user", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	if l.RevokeOtherSessions {
+		_, err := cfg.queries.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{
+			UserID:   user.ID,
+			FamilyID: token.FamilyID,
+		})
+		if err != nil {
+			requestLogger(r).Error("revoking other sessions", "err", err)
+			respondWithError(w, errInternal)
+			return
+		}
+	}
 
-	respondWithJSON(w, http.StatusOK, user)
+	if pending.Valid && pending != current.PendingEmail {
+		cfg.sendEmailVerificationLater(r, user.ID, pending.String)
+	}
+
+	respondWithJSON(w, http.StatusOK, userToResponse(user, "", ""))
 }
 
 func (cfg *apiConfig) delete_chirpEndpoint(w http.ResponseWriter, r *http.Request) {
@@ -442,15 +869,15 @@ func (cfg *apiConfig) delete_chirpEndpoint(w http.ResponseWriter, r *http.Reques
 
 	chirpIdUuid, err := uuid.Parse(chirpId)
 	if err != nil {
-		log.Printf("Error transforming uuid: %s", err)
-		respondWithError(w, http.StatusNotFound, "Invalid uuid")
+		requestLogger(r).Info("transforming uuid", "err", err)
+		respondWithError(w, errChirpNotFound)
 		return
 	}
 
 	user_token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Error getting token from header: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("getting token from header", "err", err)
+		respondWithError(w, errTokenMissing)
 		return
 	}
 
@@ -461,28 +888,213 @@ func (cfg *apiConfig) delete_chirpEndpoint(w http.ResponseWriter, r *http.Reques
 
 	user_id, err := cfg.queries.GetUserForToken(r.Context(), user_token)
 	if err != nil || !user_id.Valid {
-		log.Printf("Error getting user for token: %v", err)
-		respondWithError(w, http.StatusUnauthorized, "Incorrect or non existent token")
+		requestLogger(r).Info("getting user for token", "err", err)
+		respondWithError(w, errTokenInvalid)
 		return
 	}
+	setRequestUser(r, user_id.UUID)
 
 	chirp, err := cfg.queries.GetChirp(r.Context(), chirpIdUuid)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
-		log.Printf("Error getting chirp: %v", err)
-		respondWithError(w, http.StatusNotFound, "Chirp was not found")
+		requestLogger(r).Info("getting chirp", "err", err)
+		respondWithError(w, errChirpNotFound)
 		return
 	}
 
 	if chirp.UserID != user_id.UUID {
-		log.Printf("Error chirp user_id doesn't match users id")
-		respondWithError(w, http.StatusForbidden, "Incorrect or non existent token")
+		requestLogger(r).Info("chirp belongs to another user", "chirp_id", chirp.ID)
+		respondWithError(w, errNotOwner)
 		return
 	}
 
 	err = cfg.queries.DeleteChirp(r.Context(), chirp.ID)
 	if err != nil {
-		log.Printf("Error deleting the chirp: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		requestLogger(r).Error("deleting the chirp", "err", err)
+		respondWithError(w, errInternal)
 		return
 	}
+
+	cfg.publishChirpEvent(events.ChirpDeleted, chirp.UserID, chirpDeletedEvent{
+		ID:     chirp.ID,
+		UserID: chirp.UserID,
+	})
+}
+
+// canPost checks that the user may write chirps. Suspending a user revokes
+// their refresh tokens, but an access token stays valid until it expires,
+// so the account is looked up on every write. On failure the error response
+// has already been sent.
+func (cfg *apiConfig) canPost(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	author, err := cfg.queries.GetUserWithId(r.Context(), userID)
+	if err != nil {
+		requestLogger(r).Error("getting user", "err", err)
+		respondWithError(w, databaseError(err))
+		return false
+	}
+	if author.SuspendedAt.Valid {
+		respondWithError(w, errAccountSuspended)
+		return false
+	}
+	if cfg.requireVerifiedEmail && !author.EmailVerifiedAt.Valid {
+		respondWithError(w, errEmailNotVerified)
+		return false
+	}
+	return true
+}
+
+// canInteract checks that the user may like, rechirp, follow and report.
+// Suspended users can still read and take back what they did before.
+func (cfg *apiConfig) canInteract(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	user, err := cfg.queries.GetUserWithId(r.Context(), userID)
+	if err != nil {
+		requestLogger(r).Error("getting user", "err", err)
+		respondWithError(w, databaseError(err))
+		return false
+	}
+	if user.SuspendedAt.Valid {
+		respondWithError(w, errAccountSuspended)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) update_chirpEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		requestLogger(r).Info("transforming uuid", "err", err)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.canPost(w, r, user_id) {
+		return
+	}
+
+	type payload struct {
+		Body string `json:"body"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var putVal payload
+	if err := decoder.Decode(&putVal); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	moderated, ok := cfg.moderateChirp(w, r, putVal.Body)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.queries.GetChirp(r.Context(), chirpID)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		requestLogger(r).Info("getting chirp", "err", err)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	if chirp.UserID != user_id {
+		requestLogger(r).Info("chirp belongs to another user", "chirp_id", chirp.ID)
+		respondWithError(w, errNotOwner)
+		return
+	}
+
+	chirp, err = cfg.queries.UpdateChirp(r.Context(), database.UpdateChirpParams{
+		ID:   chirp.ID,
+		Body: moderated.Body,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted since we looked it up.
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("updating chirp", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	if err := cfg.saveChirpEntities(r.Context(), chirp); err != nil {
+		requestLogger(r).Error("saving chirp entities", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	cfg.flagChirp(r, chirp.ID, moderated)
+
+	// Hidden chirps stay editable by their author, but subscribers must
+	// not see the new body.
+	if !chirp.HiddenAt.Valid {
+		cfg.publishChirpEvent(events.ChirpUpdated, chirp.UserID, chirpToResponse(chirp))
+	}
+
+	res := chirpToResponse(chirp)
+	if err := cfg.setViewerState(r.Context(), uuid.NullUUID{UUID: user_id, Valid: true}, &res); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) get_chirp_revisionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		requestLogger(r).Info("transforming uuid", "err", err)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	// Deleted chirps take their history with them.
+	chirp, err := cfg.queries.GetChirp(r.Context(), chirpID)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		requestLogger(r).Info("getting chirp", "err", err)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	if !cfg.canView(r, chirp) {
+		requestLogger(r).Info("chirp is hidden", "chirp_id", chirp.ID)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	revisions, err := cfg.queries.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		requestLogger(r).Error("listing chirp revisions", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	res := make([]ChirpRevisionResponse, 0, len(revisions))
+	for _, rev := range revisions {
+		res = append(res, ChirpRevisionResponse{
+			ID:         rev.ID,
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
 }
@@ -0,0 +1,1494 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/entities"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/events"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/mail"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/memstore"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/moderation"
+	"github.com/google/uuid"
+)
+
+type testServer struct {
+	t       *testing.T
+	cfg     *apiConfig
+	handler http.Handler
+	outbox  *mail.Outbox
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	cfg := &apiConfig{
+		queries:   memstore.New(),
+		platform:  "dev",
+		secret:    "test-secret-0123456789",
+		polkaKey:  "test-polka-key",
+		publicURL: "http://chirpy.test",
+		events:    events.NewBroker(16),
+		logger:    slog.New(slog.DiscardHandler),
+
+		moderation: newModerator(moderation.DefaultRules()),
+	}
+	cfg.metrics = cfg.newServerMetrics()
+	outbox := &mail.Outbox{From: "chirpy@localhost"}
+	cfg.mailer = outbox
+
+	return &testServer{t: t, cfg: cfg, handler: cfg.routes(t.TempDir()), outbox: outbox}
+}
+
+func (ts *testServer) do(method, path, authorization string, body any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			ts.t.Fatalf("encoding request body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decoding response body %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+// signup creates a user and logs them in.
+func (ts *testServer) signup(email string) UserResponse {
+	ts.t.Helper()
+	return ts.signupWithHandle(email, "")
+}
+
+func (ts *testServer) signupWithHandle(email, handle string) UserResponse {
+	ts.t.Helper()
+
+	creds := map[string]string{"email": email, "password": "hunter2", "handle": handle}
+	if rec := ts.do("POST", "/api/users", "", creds); rec.Code != http.StatusCreated {
+		ts.t.Fatalf("create user: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := ts.do("POST", "/api/login", "", creds)
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("login: got status %d: %s", rec.Code, rec.Body)
+	}
+	return decode[UserResponse](ts.t, rec)
+}
+
+// signupWithRole creates a user with the role and logs them in, so the
+// token carries it.
+func (ts *testServer) signupWithRole(email string, role auth.Role) UserResponse {
+	ts.t.Helper()
+	ts.signup(email)
+
+	n, err := ts.cfg.queries.SetUserRole(context.Background(), database.SetUserRoleParams{Email: email, Role: string(role)})
+	if err != nil || n != 1 {
+		ts.t.Fatalf("set user role: %d rows, %v", n, err)
+	}
+
+	rec := ts.do("POST", "/api/login", "", map[string]string{"email": email, "password": "hunter2"})
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("login: got status %d: %s", rec.Code, rec.Body)
+	}
+	return decode[UserResponse](ts.t, rec)
+}
+
+type testChirp struct {
+	ID            uuid.UUID         `json:"id"`
+	Body          string            `json:"body"`
+	UserID        uuid.UUID         `json:"user_id"`
+	Edited        bool              `json:"edited"`
+	RevisionCount int32             `json:"revision_count"`
+	InReplyTo     uuid.NullUUID     `json:"in_reply_to"`
+	ReplyCount    int32             `json:"reply_count"`
+	Deleted       bool              `json:"deleted"`
+	LikeCount     int32             `json:"like_count"`
+	RechirpCount  int32             `json:"rechirp_count"`
+	LikedByMe     *bool             `json:"liked_by_me"`
+	RechirpedByMe *bool             `json:"rechirped_by_me"`
+	Entities      []entities.Entity `json:"entities"`
+}
+
+func (ts *testServer) chirp(user UserResponse, body string) testChirp {
+	ts.t.Helper()
+	return ts.reply(user, body, uuid.NullUUID{})
+}
+
+func (ts *testServer) reply(user UserResponse, body string, inReplyTo uuid.NullUUID) testChirp {
+	ts.t.Helper()
+
+	rec := ts.do("POST", "/api/chirps", "Bearer "+user.Token, map[string]any{"body": body, "user_id": user.ID, "in_reply_to": inReplyTo})
+	if rec.Code != http.StatusCreated {
+		ts.t.Fatalf("create chirp: got status %d: %s", rec.Code, rec.Body)
+	}
+	return decode[testChirp](ts.t, rec)
+}
+
+func TestLogin(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signup("walt@breakingbad.com")
+
+	if user.Token == "" || user.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %+v", user)
+	}
+
+	rec := ts.do("POST", "/api/login", "", login{Email: "walt@breakingbad.com", Password: "wrong"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", rec.Code)
+	}
+}
+
+func TestCreateChirp(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signup("walt@breakingbad.com")
+
+	chirp := ts.chirp(user, "I had something interesting for breakfast")
+	if chirp.UserID != user.ID {
+		t.Fatalf("expected chirp by %s, got %s", user.ID, chirp.UserID)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		want          int
+	}{
+		{"too long", "Bearer " + user.Token, strings.Repeat("a", 141), http.StatusBadRequest},
+		{"missing token", "", "hello", http.StatusUnauthorized},
+		{"invalid token", "Bearer nope", "hello", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := ts.do("POST", "/api/chirps", tc.authorization, map[string]any{"body": tc.body, "user_id": user.ID})
+			if rec.Code != tc.want {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetChirpsPagination(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	jesse := ts.signup("jesse@breakingbad.com")
+
+	first := ts.chirp(walt, "one")
+	ts.chirp(jesse, "two")
+	last := ts.chirp(walt, "three")
+
+	rec := ts.do("GET", "/api/chirps?limit=2", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	page := decode[[]testChirp](t, rec)
+	if len(page) != 2 || page[0].ID != first.ID {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	link := rec.Header().Get("Link")
+	next, _, found := strings.Cut(strings.TrimPrefix(link, "<"), ">")
+	if !found {
+		t.Fatalf("expected a next Link header, got %q", link)
+	}
+
+	rec = ts.do("GET", next, "", nil)
+	page = decode[[]testChirp](t, rec)
+	if len(page) != 1 || page[0].ID != last.ID {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+	if rec.Header().Get("Link") != "" {
+		t.Fatalf("expected no Link header on the last page")
+	}
+
+	rec = ts.do("GET", "/api/chirps?sort=desc&author_id="+walt.ID.String(), "", nil)
+	page = decode[[]testChirp](t, rec)
+	if len(page) != 2 || page[0].ID != last.ID || page[1].ID != first.ID {
+		t.Fatalf("unexpected filtered page: %+v", page)
+	}
+
+	if rec := ts.do("GET", "/api/chirps?cursor=garbage", "", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed cursor, got %d", rec.Code)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signup("walt@breakingbad.com")
+
+	rec := ts.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: got status %d: %s", rec.Code, rec.Body)
+	}
+	rotated := decode[refreshResponse](t, rec)
+	if rotated.Token == "" || rotated.RefreshToken == "" || rotated.RefreshToken == user.RefreshToken {
+		t.Fatalf("expected a new token pair, got %+v", rotated)
+	}
+
+	// Replaying the old token revokes the whole family.
+	if rec := ts.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a reused token, got %d", rec.Code)
+	}
+	if rec := ts.do("POST", "/api/refresh", "Bearer "+rotated.RefreshToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the rotated token to be revoked with its family, got %d", rec.Code)
+	}
+}
+
+func TestFollowAndTimeline(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	jesse := ts.signup("jesse@breakingbad.com")
+
+	chirp := ts.chirp(jesse, "yo")
+	ts.chirp(walt, "say my name")
+
+	if rec := ts.do("POST", "/api/users/"+walt.ID.String()+"/follow", "Bearer "+walt.Token, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when following yourself, got %d", rec.Code)
+	}
+	if rec := ts.do("POST", "/api/users/"+jesse.ID.String()+"/follow", "Bearer "+walt.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("follow: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	timeline := decode[[]testChirp](t, ts.do("GET", "/api/timeline", "Bearer "+walt.Token, nil))
+	if len(timeline) != 1 || timeline[0].ID != chirp.ID {
+		t.Fatalf("unexpected timeline: %+v", timeline)
+	}
+
+	profile := decode[UserProfileResponse](t, ts.do("GET", "/api/users/"+jesse.ID.String(), "", nil))
+	if profile.FollowerCount != 1 || profile.FollowingCount != 0 {
+		t.Fatalf("unexpected profile counts: %+v", profile)
+	}
+
+	// Public user data leaves out email addresses.
+	for _, path := range []string{"/api/users/" + jesse.ID.String(), "/api/users/" + jesse.ID.String() + "/followers", "/api/users/" + walt.ID.String() + "/following"} {
+		rec := ts.do("GET", path, "", nil)
+		if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "@breakingbad.com") {
+			t.Fatalf("%s: expected no email addresses, got %d: %s", path, rec.Code, rec.Body)
+		}
+	}
+
+	if rec := ts.do("DELETE", "/api/users/"+jesse.ID.String()+"/follow", "Bearer "+walt.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unfollow: got status %d", rec.Code)
+	}
+	timeline = decode[[]testChirp](t, ts.do("GET", "/api/timeline", "Bearer "+walt.Token, nil))
+	if len(timeline) != 0 {
+		t.Fatalf("expected an empty timeline after unfollowing, got %+v", timeline)
+	}
+}
+
+func TestPolkaWebhook(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signup("walt@breakingbad.com")
+
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]any{"user_id": user.ID}}
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          any
+		want          int
+	}{
+		{"missing key", "", upgrade, http.StatusUnauthorized},
+		{"wrong key", "ApiKey nope", upgrade, http.StatusUnauthorized},
+		{"unknown event", "ApiKey test-polka-key", map[string]any{"event": "user.payment_failed"}, http.StatusNoContent},
+		{"unknown user", "ApiKey test-polka-key", map[string]any{"event": "user.upgraded", "data": map[string]any{"user_id": uuid.New()}}, http.StatusNotFound},
+		{"upgrade", "ApiKey test-polka-key", upgrade, http.StatusNoContent},
+		{"repeated upgrade", "ApiKey test-polka-key", upgrade, http.StatusNoContent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := ts.do("POST", "/api/polka/webhooks", tc.authorization, tc.body)
+			if rec.Code != tc.want {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+
+	rec := ts.do("POST", "/api/login", "", login{Email: "walt@breakingbad.com", Password: "hunter2"})
+	if !decode[UserResponse](t, rec).IsChirpyRed {
+		t.Fatalf("expected user to be upgraded to Chirpy Red")
+	}
+}
+
+func TestMetricsNegotiation(t *testing.T) {
+	ts := newTestServer(t)
+	admin := "Bearer " + ts.signupWithRole("admin@chirpy.example", auth.RoleAdmin).Token
+	ts.do("GET", "/api/healthz", "", nil)
+
+	rec := ts.do("GET", "/admin/metrics", admin, nil)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected the HTML page by default, got %q", ct)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/metrics", nil)
+	req.Header.Set("Accept", "text/plain;version=0.0.4;q=0.3,*/*;q=0.2")
+	req.Header.Set("Authorization", admin)
+	rec = httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("expected the exposition format, got %q", ct)
+	}
+	want := `chirpy_http_requests_total{route="GET /api/healthz",status="2xx"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("expected %q in:\n%s", want, rec.Body)
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signup("walt@breakingbad.com")
+
+	var buf bytes.Buffer
+	ts.cfg.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	req := httptest.NewRequest("GET", "/api/timeline", nil)
+	req.Header.Set("Authorization", "Bearer "+user.Token)
+	req.Header.Set("X-Request-ID", "req-42")
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-ID"); got != "req-42" {
+		t.Fatalf("expected the request ID to be echoed, got %q", got)
+	}
+
+	var entry struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		UserID    string `json:"user_id"`
+		Route     string `json:"route"`
+		Status    int    `json:"status"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decoding access log %q: %v", buf.String(), err)
+	}
+	if entry.Msg != "request" || entry.RequestID != "req-42" || entry.UserID != user.ID.String() ||
+		entry.Route != "GET /api/timeline" || entry.Status != http.StatusOK {
+		t.Fatalf("unexpected access log: %s", buf.String())
+	}
+
+	rec = ts.do("GET", "/api/healthz", "", nil)
+	if _, err := uuid.Parse(rec.Header().Get("X-Request-ID")); err != nil {
+		t.Fatalf("expected a generated request ID, got %q", rec.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	jesse := ts.signup("jesse@breakingbad.com")
+	chirp := ts.chirp(walt, "say my name")
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		body          any
+		status        int
+		code          string
+		field         string
+	}{
+		{"email taken", "POST", "/api/users", "", login{Email: "walt@breakingbad.com", Password: "hunter2"}, http.StatusConflict, "email_taken", ""},
+		{"missing email", "POST", "/api/users", "", login{Password: "hunter2"}, http.StatusBadRequest, "validation_failed", "email"},
+		{"invalid json", "POST", "/api/login", "", "nope", http.StatusBadRequest, "invalid_json", ""},
+		{"chirp too long", "POST", "/api/chirps", "Bearer " + walt.Token, map[string]any{"body": strings.Repeat("a", 141), "user_id": walt.ID}, http.StatusBadRequest, "chirp_too_long", "body"},
+		{"missing token", "GET", "/api/timeline", "", nil, http.StatusUnauthorized, "token_missing", ""},
+		{"not owner", "DELETE", "/api/chirps/" + chirp.ID.String(), "Bearer " + jesse.RefreshToken, nil, http.StatusForbidden, "not_owner", ""},
+		{"unknown chirp", "GET", "/api/chirps/" + uuid.NewString(), "", nil, http.StatusNotFound, "chirp_not_found", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := ts.do(tc.method, tc.path, tc.authorization, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Fatalf("unexpected content type %q", ct)
+			}
+
+			problem := decode[problemDetails](t, rec)
+			if problem.Code != tc.code || problem.Status != tc.status {
+				t.Fatalf("unexpected problem: %+v", problem)
+			}
+			if problem.RequestID == "" || problem.RequestID != rec.Header().Get("X-Request-ID") {
+				t.Fatalf("expected the request ID in the problem, got %q", problem.RequestID)
+			}
+			if tc.field != "" && (len(problem.Errors) != 1 || problem.Errors[0].Field != tc.field) {
+				t.Fatalf("expected a field error for %s, got %+v", tc.field, problem.Errors)
+			}
+		})
+	}
+}
+
+func TestEditChirp(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	jesse := ts.signup("jesse@breakingbad.com")
+	chirp := ts.chirp(walt, "say my nmae")
+	path := "/api/chirps/" + chirp.ID.String()
+
+	if rec := ts.do("PUT", path, "Bearer "+jesse.Token, map[string]any{"body": "yo"}); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when editing someone else's chirp, got %d", rec.Code)
+	}
+	if rec := ts.do("PUT", path, "Bearer "+walt.Token, map[string]any{"body": strings.Repeat("a", 141)}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a chirp that is too long, got %d", rec.Code)
+	}
+
+	rec := ts.do("PUT", path, "Bearer "+walt.Token, map[string]any{"body": "say my name kerfuffle"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("edit: got status %d: %s", rec.Code, rec.Body)
+	}
+	edited := decode[testChirp](t, rec)
+	if edited.Body != "say my name ****" || !edited.Edited || edited.RevisionCount != 1 {
+		t.Fatalf("unexpected edited chirp: %+v", edited)
+	}
+
+	revisions := decode[[]ChirpRevisionResponse](t, ts.do("GET", path+"/revisions", "", nil))
+	if len(revisions) != 1 || revisions[0].Body != "say my nmae" {
+		t.Fatalf("unexpected revisions: %+v", revisions)
+	}
+
+	// With a reply the deleted chirp stays behind as a tombstone.
+	ts.reply(jesse, "nope", uuid.NullUUID{UUID: chirp.ID, Valid: true})
+	if rec := ts.do("DELETE", path, "Bearer "+walt.RefreshToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete: got status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := ts.do("GET", path+"/revisions", "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("revisions of a tombstone: expected 404, got %d", rec.Code)
+	}
+}
+
+func TestThreads(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	jesse := ts.signup("jesse@breakingbad.com")
+
+	root := ts.chirp(walt, "we need to cook")
+	reply := ts.reply(jesse, "yeah science", uuid.NullUUID{UUID: root.ID, Valid: true})
+	nested := ts.reply(walt, "say my name", uuid.NullUUID{UUID: reply.ID, Valid: true})
+
+	type testThread struct {
+		Ancestors []testChirp `json:"ancestors"`
+		Chirp     testChirp   `json:"chirp"`
+		Replies   []struct {
+			testChirp
+			Depth int32 `json:"depth"`
+		} `json:"replies"`
+	}
+
+	thread := decode[testThread](t, ts.do("GET", "/api/chirps/"+root.ID.String()+"/thread", "", nil))
+	if thread.Chirp.ReplyCount != 1 || len(thread.Ancestors) != 0 || len(thread.Replies) != 2 {
+		t.Fatalf("unexpected root thread: %+v", thread)
+	}
+	if thread.Replies[0].ID != reply.ID || thread.Replies[0].Depth != 1 || thread.Replies[1].ID != nested.ID || thread.Replies[1].Depth != 2 {
+		t.Fatalf("unexpected replies: %+v", thread.Replies)
+	}
+
+	rec := ts.do("POST", "/api/chirps", "Bearer "+walt.Token, map[string]any{"body": "hi", "user_id": walt.ID, "in_reply_to": uuid.New()})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when replying to a missing chirp, got %d", rec.Code)
+	}
+
+	// The root has a reply, so deleting it leaves a placeholder.
+	if rec := ts.do("DELETE", "/api/chirps/"+root.ID.String(), "Bearer "+walt.RefreshToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	thread = decode[testThread](t, ts.do("GET", "/api/chirps/"+nested.ID.String()+"/thread", "", nil))
+	if len(thread.Ancestors) != 2 || !thread.Ancestors[0].Deleted || thread.Ancestors[0].Body != "" || thread.Ancestors[1].ID != reply.ID {
+		t.Fatalf("unexpected ancestors after deleting the root: %+v", thread.Ancestors)
+	}
+
+	chirps := decode[[]testChirp](t, ts.do("GET", "/api/chirps", "", nil))
+	if len(chirps) != 2 {
+		t.Fatalf("expected the placeholder to be left out of listings, got %+v", chirps)
+	}
+
+	// Deleting a leaf removes it and gives the parent its reply back.
+	if rec := ts.do("DELETE", "/api/chirps/"+nested.ID.String(), "Bearer "+walt.RefreshToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete: got status %d: %s", rec.Code, rec.Body)
+	}
+	if got := decode[testChirp](t, ts.do("GET", "/api/chirps/"+reply.ID.String(), "", nil)); got.ReplyCount != 0 {
+		t.Fatalf("expected no replies left, got %d", got.ReplyCount)
+	}
+}
+
+func TestLikesAndRechirps(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	jesse := ts.signup("jesse@breakingbad.com")
+
+	chirp := ts.chirp(walt, "we need to cook")
+	path := "/api/chirps/" + chirp.ID.String()
+
+	if rec := ts.do("POST", path+"/like", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+	if rec := ts.do("POST", "/api/chirps/"+uuid.NewString()+"/like", "Bearer "+walt.Token, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing chirp, got %d", rec.Code)
+	}
+
+	// Liking twice, even concurrently, only counts once.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ts.do("POST", path+"/like", "Bearer "+jesse.Token, nil)
+		}()
+	}
+	wg.Wait()
+
+	if rec := ts.do("POST", path+"/rechirp", "Bearer "+jesse.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("rechirp: got status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := ts.do("POST", path+"/like", "Bearer "+walt.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("like: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	got := decode[testChirp](t, ts.do("GET", path, "Bearer "+jesse.Token, nil))
+	if got.LikeCount != 2 || got.RechirpCount != 1 || got.LikedByMe == nil || !*got.LikedByMe || !*got.RechirpedByMe {
+		t.Fatalf("unexpected counters for jesse: %+v", got)
+	}
+	got = decode[testChirp](t, ts.do("GET", path, "", nil))
+	if got.LikedByMe != nil || got.RechirpedByMe != nil {
+		t.Fatalf("expected no viewer state when anonymous, got %+v", got)
+	}
+	if rec := ts.do("GET", path, "Bearer nonsense", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a bad token, got %d", rec.Code)
+	}
+
+	rec := ts.do("GET", path+"/likes?limit=1", "", nil)
+	if strings.Contains(rec.Body.String(), "@breakingbad.com") {
+		t.Fatalf("likes list email addresses: %s", rec.Body)
+	}
+	likes := decode[[]LikeResponse](t, rec)
+	if len(likes) != 1 || likes[0].ID != walt.ID {
+		t.Fatalf("expected the latest like first, got %+v", likes)
+	}
+	rechirps := decode[[]RechirpResponse](t, ts.do("GET", path+"/rechirps", "", nil))
+	if len(rechirps) != 1 || rechirps[0].ID != jesse.ID {
+		t.Fatalf("unexpected rechirps: %+v", rechirps)
+	}
+
+	if rec := ts.do("DELETE", path+"/like", "Bearer "+jesse.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unlike: got status %d: %s", rec.Code, rec.Body)
+	}
+	ts.do("DELETE", path+"/like", "Bearer "+jesse.Token, nil)
+
+	chirps := decode[[]testChirp](t, ts.do("GET", "/api/chirps", "Bearer "+jesse.Token, nil))
+	if len(chirps) != 1 || chirps[0].LikeCount != 1 || *chirps[0].LikedByMe || !*chirps[0].RechirpedByMe {
+		t.Fatalf("unexpected listing after unlike: %+v", chirps)
+	}
+}
+
+func TestTagsAndMentions(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+
+	jesse := ts.signupWithHandle("jesse@breakingbad.com", "Jesse")
+	if jesse.Handle != "jesse" {
+		t.Fatalf("expected a normalised handle, got %q", jesse.Handle)
+	}
+
+	creds := map[string]string{"email": "pinkman@breakingbad.com", "password": "hunter2", "handle": "jesse"}
+	if rec := ts.do("POST", "/api/users", "", creds); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a taken handle, got %d", rec.Code)
+	}
+	creds["handle"] = "not a handle"
+	if rec := ts.do("POST", "/api/users", "", creds); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid handle, got %d", rec.Code)
+	}
+
+	chirp := ts.chirp(walt, "@jesse we need to #Cook #cook")
+	want := []entities.Entity{
+		{Type: entities.Mention, Text: "jesse", Start: 0, End: 6},
+		{Type: entities.Hashtag, Text: "cook", Start: 18, End: 23},
+		{Type: entities.Hashtag, Text: "cook", Start: 24, End: 29},
+	}
+	if !reflect.DeepEqual(chirp.Entities, want) {
+		t.Fatalf("unexpected entities %+v", chirp.Entities)
+	}
+	ts.chirp(walt, "#science is the #cook")
+
+	tagged := decode[[]testChirp](t, ts.do("GET", "/api/tags/%23Cook/chirps", "", nil))
+	if len(tagged) != 2 {
+		t.Fatalf("expected both chirps under #cook, got %+v", tagged)
+	}
+
+	trending := decode[[]TrendingTagResponse](t, ts.do("GET", "/api/tags/trending", "", nil))
+	if len(trending) != 2 || trending[0].Tag != "cook" || trending[0].Uses != 2 || trending[1].Tag != "science" {
+		t.Fatalf("unexpected trending tags %+v", trending)
+	}
+
+	mentions := decode[[]testChirp](t, ts.do("GET", "/api/users/me/mentions", "Bearer "+jesse.Token, nil))
+	if len(mentions) != 1 || mentions[0].ID != chirp.ID {
+		t.Fatalf("unexpected mentions %+v", mentions)
+	}
+
+	// Editing the chirp drops the mention and the tag.
+	if rec := ts.do("PUT", "/api/chirps/"+chirp.ID.String(), "Bearer "+walt.Token, map[string]string{"body": "never mind"}); rec.Code != http.StatusOK {
+		t.Fatalf("edit: got status %d: %s", rec.Code, rec.Body)
+	}
+	if mentions := decode[[]testChirp](t, ts.do("GET", "/api/users/me/mentions", "Bearer "+jesse.Token, nil)); len(mentions) != 0 {
+		t.Fatalf("expected no mentions after the edit, got %+v", mentions)
+	}
+	if tagged := decode[[]testChirp](t, ts.do("GET", "/api/tags/cook/chirps", "", nil)); len(tagged) != 1 {
+		t.Fatalf("expected one chirp under #cook after the edit, got %+v", tagged)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signupWithHandle("walt@breakingbad.com", "heisenberg")
+	jesse := ts.signup("jesse@breakingbad.com")
+
+	sky := ts.chirp(walt, "the blue sky is <pure>")
+	ts.chirp(walt, "blue is my favourite colour")
+	ts.chirp(jesse, "look at the sky")
+
+	search := func(q string) []SearchResultResponse {
+		t.Helper()
+		rec := ts.do("GET", "/api/search/chirps?q="+url.QueryEscape(q), "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("search %q: got status %d: %s", q, rec.Code, rec.Body)
+		}
+		return decode[[]SearchResultResponse](t, rec)
+	}
+
+	results := search(`"blue sky"`)
+	if len(results) != 1 || results[0].ID != sky.ID {
+		t.Fatalf("unexpected phrase results %+v", results)
+	}
+	if want := "the <mark>blue</mark> <mark>sky</mark> is &lt;pure&gt;"; results[0].Snippet != want {
+		t.Fatalf("snippet = %q, want %q", results[0].Snippet, want)
+	}
+
+	if results := search("sky -blue"); len(results) != 1 || results[0].UserID != jesse.ID {
+		t.Fatalf("unexpected exclusion results %+v", results)
+	}
+	if results := search("from:heisenberg"); len(results) != 2 {
+		t.Fatalf("expected both of walt's chirps, got %+v", results)
+	}
+	if results := search("sky since:2000-01-01 until:2000-12-31"); len(results) != 0 {
+		t.Fatalf("expected nothing from 2000, got %+v", results)
+	}
+
+	// Ranked pagination walks every result exactly once.
+	seen := make(map[uuid.UUID]bool)
+	path := "/api/search/chirps?q=sky&limit=1"
+	for range 3 {
+		rec := ts.do("GET", path, "", nil)
+		for _, res := range decode[[]SearchResultResponse](t, rec) {
+			seen[res.ID] = true
+		}
+		link := rec.Header().Get("Link")
+		if link == "" {
+			break
+		}
+		path = strings.TrimPrefix(link[:strings.Index(link, ">")], "<")
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected two distinct results across pages, got %d", len(seen))
+	}
+
+	for _, q := range []string{"", "since:tomorrow"} {
+		if rec := ts.do("GET", "/api/search/chirps?q="+url.QueryEscape(q), "", nil); rec.Code != http.StatusBadRequest {
+			t.Fatalf("search %q: expected 400, got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestModeration(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	admin := "Bearer " + ts.signupWithRole("hank@dea.gov", auth.RoleModerator).Token
+
+	if chirp := ts.chirp(walt, "what a Kerfuffle!  honestly"); chirp.Body != "what a ****!  honestly" {
+		t.Fatalf("default word list: body = %q", chirp.Body)
+	}
+
+	for _, tc := range []struct {
+		authorization string
+		status        int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer nope", http.StatusUnauthorized},
+		{"Bearer " + walt.Token, http.StatusForbidden},
+	} {
+		if rec := ts.do("GET", "/admin/moderation/rules", tc.authorization, nil); rec.Code != tc.status {
+			t.Fatalf("authorization %q: expected %d, got %d", tc.authorization, tc.status, rec.Code)
+		}
+	}
+
+	createRule := func(kind, action, value string) ModerationRuleResponse {
+		t.Helper()
+		rec := ts.do("POST", "/admin/moderation/rules", admin, map[string]string{"kind": kind, "action": action, "value": value})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create %s rule: got status %d: %s", kind, rec.Code, rec.Body)
+		}
+		return decode[ModerationRuleResponse](t, rec)
+	}
+	createRule("domain", "reject", "spam.example")
+	createRule("regex", "flag", `(?i)blue (meth|crystal)`)
+	mentions := createRule("max_mentions", "mask", "1")
+
+	invalid := []map[string]string{
+		{"kind": "regex", "action": "flag", "value": "("},
+		{"kind": "word", "action": "delete", "value": "meth"},
+		{"kind": "colour", "action": "mask", "value": "blue"},
+	}
+	for _, body := range invalid {
+		if rec := ts.do("POST", "/admin/moderation/rules", admin, body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("rule %v: expected 400, got %d", body, rec.Code)
+		}
+	}
+	if rec := ts.do("POST", "/admin/moderation/rules", admin, map[string]string{"kind": "domain", "action": "flag", "value": "spam.example"}); rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate rule: expected 409, got %d", rec.Code)
+	}
+
+	rec := ts.do("POST", "/api/chirps", "Bearer "+walt.Token, map[string]any{"body": "deals at www.spam.example/now", "user_id": walt.ID})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("blocked domain: expected 400, got %d", rec.Code)
+	}
+	if problem := decode[problemDetails](t, rec); problem.Code != "chirp_rejected" || len(problem.Errors) != 1 || problem.Errors[0].Field != "body" {
+		t.Fatalf("unexpected rejection %+v", problem)
+	}
+
+	if chirp := ts.chirp(walt, "@jesse @skyler dinner?"); chirp.Body != "@jesse **** dinner?" {
+		t.Fatalf("max mentions: body = %q", chirp.Body)
+	}
+	if rec := ts.do("DELETE", "/admin/moderation/rules/"+mentions.ID.String(), admin, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete rule: expected 204, got %d", rec.Code)
+	}
+	if rec := ts.do("DELETE", "/admin/moderation/rules/"+mentions.ID.String(), admin, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("delete missing rule: expected 404, got %d", rec.Code)
+	}
+	if chirp := ts.chirp(walt, "@jesse @skyler dinner?"); chirp.Body != "@jesse @skyler dinner?" {
+		t.Fatalf("deleted rule still applied: body = %q", chirp.Body)
+	}
+
+	flagged := ts.chirp(walt, "the Blue Crystal is back")
+	if flagged.Body != "the Blue Crystal is back" {
+		t.Fatalf("flagging changed the body to %q", flagged.Body)
+	}
+	queue := decode[[]QueueItemResponse](t, ts.do("GET", "/admin/moderation/queue", admin, nil))
+	if len(queue) != 1 || queue[0].ID != flagged.ID || len(queue[0].Rules) != 1 || queue[0].ReportCount != 0 {
+		t.Fatalf("unexpected review queue %+v", queue)
+	}
+	if rec := ts.do("POST", "/admin/moderation/"+flagged.ID.String()+"/resolve", admin, map[string]string{"action": "dismiss"}); rec.Code != http.StatusNoContent {
+		t.Fatalf("dismiss: expected 204, got %d", rec.Code)
+	}
+	if queue := decode[[]QueueItemResponse](t, ts.do("GET", "/admin/moderation/queue", admin, nil)); len(queue) != 0 {
+		t.Fatalf("expected an empty review queue, got %+v", queue)
+	}
+
+	rules := decode[[]ModerationRuleResponse](t, ts.do("GET", "/admin/moderation/rules", admin, nil))
+	if len(rules) != 2 || rules[0].Kind != "domain" || rules[1].Kind != "regex" {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+}
+
+func TestReportsAndResolutions(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	jesse := ts.signup("jesse@breakingbad.com")
+	skyler := ts.signup("skyler@breakingbad.com")
+	admin := "Bearer " + ts.signupWithRole("hank@dea.gov", auth.RoleModerator).Token
+
+	report := func(user UserResponse, chirp testChirp, reason string) int {
+		t.Helper()
+		return ts.do("POST", "/api/chirps/"+chirp.ID.String()+"/reports", "Bearer "+user.Token, map[string]string{"reason": reason}).Code
+	}
+	resolve := func(chirp testChirp, action string) int {
+		t.Helper()
+		return ts.do("POST", "/admin/moderation/"+chirp.ID.String()+"/resolve", admin, map[string]string{"action": action}).Code
+	}
+
+	root := ts.chirp(skyler, "anyone know a good lawyer?")
+	spam := ts.reply(walt, "buy my product", uuid.NullUUID{UUID: root.ID, Valid: true})
+	followup := ts.reply(jesse, "no thanks", uuid.NullUUID{UUID: spam.ID, Valid: true})
+	if code := report(jesse, spam, "spam"); code != http.StatusCreated {
+		t.Fatalf("report: expected 201, got %d", code)
+	}
+	if code := report(jesse, spam, "spam"); code != http.StatusConflict {
+		t.Fatalf("repeated report: expected 409, got %d", code)
+	}
+	if code := report(skyler, spam, "boring"); code != http.StatusBadRequest {
+		t.Fatalf("unknown reason: expected 400, got %d", code)
+	}
+	report(skyler, spam, "harassment")
+
+	queue := decode[[]QueueItemResponse](t, ts.do("GET", "/admin/moderation/queue", admin, nil))
+	if len(queue) != 1 || queue[0].ReportCount != 2 || !reflect.DeepEqual(queue[0].Reasons, []string{"harassment", "spam"}) {
+		t.Fatalf("unexpected queue %+v", queue)
+	}
+	if rec := ts.do("GET", "/admin/moderation/queue", "Bearer "+jesse.Token, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("queue as a regular user: expected 403, got %d", rec.Code)
+	}
+	if code := resolve(spam, "explode"); code != http.StatusBadRequest {
+		t.Fatalf("unknown action: expected 400, got %d", code)
+	}
+
+	// published returns the stream events sent while fn ran.
+	published := func(fn func()) []events.Event {
+		sub, _ := ts.cfg.events.Subscribe(0)
+		defer sub.Close()
+		fn()
+		var evs []events.Event
+		for {
+			select {
+			case ev := <-sub.C:
+				evs = append(evs, ev)
+			default:
+				return evs
+			}
+		}
+	}
+
+	// Hiding keeps the chirp for its author and moderators only.
+	evs := published(func() {
+		if code := resolve(spam, "hide"); code != http.StatusNoContent {
+			t.Fatalf("hide: expected 204, got %d", code)
+		}
+	})
+	if len(evs) != 1 || evs[0].Type != events.ChirpHidden || !strings.Contains(string(evs[0].Data), spam.ID.String()) {
+		t.Fatalf("hide: expected a %s event for the chirp, got %+v", events.ChirpHidden, evs)
+	}
+	if code := resolve(spam, "hide"); code != http.StatusNotFound {
+		t.Fatalf("resolving twice: expected 404, got %d", code)
+	}
+	path := "/api/chirps/" + spam.ID.String()
+	for _, tc := range []struct {
+		authorization string
+		status        int
+	}{
+		{"", http.StatusNotFound},
+		{"Bearer " + jesse.Token, http.StatusNotFound},
+		{"Bearer " + walt.Token, http.StatusOK},
+		{admin, http.StatusOK},
+	} {
+		if rec := ts.do("GET", path, tc.authorization, nil); rec.Code != tc.status {
+			t.Fatalf("get hidden chirp with %q: expected %d, got %d", tc.authorization, tc.status, rec.Code)
+		}
+	}
+	listed := func(authorization string) int {
+		t.Helper()
+		return len(decode[[]testChirp](t, ts.do("GET", "/api/chirps", authorization, nil)))
+	}
+	if n := listed(""); n != 2 {
+		t.Fatalf("hidden chirp listed for anonymous viewers")
+	}
+	if n := listed("Bearer " + walt.Token); n != 3 {
+		t.Fatalf("hidden chirp not listed for its author")
+	}
+	if n := listed(admin); n != 3 {
+		t.Fatalf("hidden chirp not listed for moderators")
+	}
+
+	// Threads leave hidden chirps out the same way.
+	thread := func(chirp testChirp, authorization string) ThreadResponse {
+		t.Helper()
+		rec := ts.do("GET", "/api/chirps/"+chirp.ID.String()+"/thread", authorization, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("thread: got status %d: %s", rec.Code, rec.Body)
+		}
+		return decode[ThreadResponse](t, rec)
+	}
+	if rec := ts.do("GET", path+"/thread", "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("thread of a hidden chirp: expected 404, got %d", rec.Code)
+	}
+	thread(spam, "Bearer "+walt.Token)
+	if n := len(thread(root, "").Replies); n != 1 {
+		t.Fatalf("expected the hidden reply to be left out, got %d replies", n)
+	}
+	if n := len(thread(root, admin).Replies); n != 2 {
+		t.Fatalf("expected moderators to see the hidden reply, got %d replies", n)
+	}
+	if n := len(thread(followup, "").Ancestors); n != 1 {
+		t.Fatalf("expected the hidden ancestor to be left out, got %d ancestors", n)
+	}
+	if n := len(thread(followup, "Bearer "+walt.Token).Ancestors); n != 2 {
+		t.Fatalf("expected the author to see the hidden ancestor, got %d ancestors", n)
+	}
+
+	// Only those who can see a hidden chirp can react to it.
+	for _, tc := range []struct {
+		method, suffix, authorization string
+		status                        int
+	}{
+		{"POST", "/like", "Bearer " + jesse.Token, http.StatusNotFound},
+		{"POST", "/rechirp", "Bearer " + jesse.Token, http.StatusNotFound},
+		{"GET", "/likes", "", http.StatusNotFound},
+		{"GET", "/rechirps", "", http.StatusNotFound},
+		{"GET", "/likes", admin, http.StatusOK},
+		{"GET", "/revisions", "", http.StatusNotFound},
+		{"GET", "/revisions", "Bearer " + walt.Token, http.StatusOK},
+		{"POST", "/like", "Bearer " + walt.Token, http.StatusNoContent},
+	} {
+		if rec := ts.do(tc.method, path+tc.suffix, tc.authorization, nil); rec.Code != tc.status {
+			t.Fatalf("%s %s on a hidden chirp: expected %d, got %d", tc.method, tc.suffix, tc.status, rec.Code)
+		}
+	}
+	if code := report(skyler, spam, "spam"); code != http.StatusNotFound {
+		t.Fatalf("report of a hidden chirp: expected 404, got %d", code)
+	}
+
+	// The author can still edit a hidden chirp, but the edit isn't streamed.
+	evs = published(func() {
+		if rec := ts.do("PUT", path, "Bearer "+walt.Token, map[string]string{"body": "buy my other product"}); rec.Code != http.StatusOK {
+			t.Fatalf("edit hidden chirp: got status %d: %s", rec.Code, rec.Body)
+		}
+	})
+	if len(evs) != 0 {
+		t.Fatalf("editing a hidden chirp published %+v", evs)
+	}
+
+	// Moderators still see it, so they can report it and delete it.
+	if rec := ts.do("POST", path+"/reports", admin, map[string]string{"reason": "spam"}); rec.Code != http.StatusCreated {
+		t.Fatalf("moderator report of a hidden chirp: got status %d: %s", rec.Code, rec.Body)
+	}
+	if code := resolve(spam, "delete"); code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", code)
+	}
+	// The chirp has a reply, so it stays behind as a tombstone.
+	if deleted := decode[testChirp](t, ts.do("GET", path, admin, nil)); !deleted.Deleted || deleted.Body != "" {
+		t.Fatalf("deleted chirp: expected a tombstone, got %+v", deleted)
+	}
+
+	rant := ts.chirp(jesse, "yo")
+	report(skyler, rant, "harassment")
+	if code := resolve(rant, "dismiss"); code != http.StatusNoContent {
+		t.Fatalf("dismiss: expected 204, got %d", code)
+	}
+	// A user can report again once their earlier report was resolved.
+	if code := report(skyler, rant, "harassment"); code != http.StatusCreated {
+		t.Fatalf("report after resolution: expected 201, got %d", code)
+	}
+	if code := resolve(rant, "suspend"); code != http.StatusNoContent {
+		t.Fatalf("suspend: expected 204, got %d", code)
+	}
+	rec := ts.do("POST", "/api/chirps", "Bearer "+jesse.Token, map[string]any{"body": "still here", "user_id": jesse.ID})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("suspended user posting: expected 403, got %d", rec.Code)
+	}
+	if rec := ts.do("PUT", "/api/chirps/"+rant.ID.String(), "Bearer "+jesse.Token, map[string]string{"body": "yo yo"}); rec.Code != http.StatusForbidden {
+		t.Fatalf("suspended user editing: expected 403, got %d", rec.Code)
+	}
+	// The access token outlives the suspension, so every write checks it.
+	for _, path := range []string{
+		"/api/chirps/" + root.ID.String() + "/like",
+		"/api/chirps/" + root.ID.String() + "/rechirp",
+		"/api/users/" + skyler.ID.String() + "/follow",
+	} {
+		if rec := ts.do("POST", path, "Bearer "+jesse.Token, nil); rec.Code != http.StatusForbidden {
+			t.Fatalf("suspended user POST %s: expected 403, got %d", path, rec.Code)
+		}
+	}
+	if code := report(jesse, root, "spam"); code != http.StatusForbidden {
+		t.Fatalf("suspended user reporting: expected 403, got %d", code)
+	}
+	creds := map[string]string{"email": "jesse@breakingbad.com", "password": "hunter2"}
+	if rec := ts.do("POST", "/api/login", "", creds); rec.Code != http.StatusForbidden {
+		t.Fatalf("suspended user login: expected 403, got %d", rec.Code)
+	}
+	if rec := ts.do("POST", "/api/refresh", "Bearer "+jesse.RefreshToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("suspended user refresh: expected 401, got %d", rec.Code)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	hank := ts.signupWithRole("hank@dea.gov", auth.RoleModerator)
+	gus := ts.signupWithRole("gus@lospollos.com", auth.RoleAdmin)
+
+	if walt.Role != "user" || hank.Role != "moderator" || gus.Role != "admin" {
+		t.Fatalf("unexpected roles %q, %q, %q", walt.Role, hank.Role, gus.Role)
+	}
+
+	for _, tc := range []struct {
+		user   UserResponse
+		path   string
+		status int
+	}{
+		{walt, "/admin/moderation/queue", http.StatusForbidden},
+		{hank, "/admin/moderation/queue", http.StatusOK},
+		{gus, "/admin/moderation/queue", http.StatusOK},
+		{walt, "/admin/metrics", http.StatusForbidden},
+		{hank, "/admin/metrics", http.StatusForbidden},
+		{gus, "/admin/metrics", http.StatusOK},
+	} {
+		rec := ts.do("GET", tc.path, "Bearer "+tc.user.Token, nil)
+		if rec.Code != tc.status {
+			t.Fatalf("%s as %s: expected %d, got %d", tc.path, tc.user.Role, tc.status, rec.Code)
+		}
+		if rec.Code == http.StatusForbidden && decode[problemDetails](t, rec).Code != "insufficient_role" {
+			t.Fatalf("%s as %s: expected insufficient_role", tc.path, tc.user.Role)
+		}
+	}
+	if rec := ts.do("GET", "/admin/metrics", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("metrics without a token: expected 401, got %d", rec.Code)
+	}
+
+	// A grant reaches existing sessions on their next refresh.
+	ts.cfg.queries.SetUserRole(context.Background(), database.SetUserRoleParams{Email: "walt@breakingbad.com", Role: "admin"})
+	rec := ts.do("POST", "/api/refresh", "Bearer "+walt.RefreshToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d", rec.Code)
+	}
+	token := decode[struct {
+		Token string `json:"token"`
+	}](t, rec).Token
+	if rec := ts.do("GET", "/admin/metrics", "Bearer "+token, nil); rec.Code != http.StatusOK {
+		t.Fatalf("metrics after grant: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+
+	forgot := func(email string) {
+		t.Helper()
+		if rec := ts.do("POST", "/api/password/forgot", "", map[string]string{"email": email}); rec.Code != http.StatusAccepted {
+			t.Fatalf("forgot %q: expected 202, got %d", email, rec.Code)
+		}
+		// The mail goes out after the response.
+		ts.cfg.background.Wait()
+	}
+	resetToken := func() string {
+		t.Helper()
+		messages := ts.outbox.Messages()
+		if len(messages) == 0 {
+			t.Fatalf("no mail was sent")
+		}
+		for _, line := range strings.Split(messages[len(messages)-1].Body, "\n") {
+			if len(line) == 64 {
+				return line
+			}
+		}
+		t.Fatalf("no token in %q", messages[len(messages)-1].Body)
+		return ""
+	}
+	reset := func(token, password string) *httptest.ResponseRecorder {
+		t.Helper()
+		return ts.do("POST", "/api/password/reset", "", map[string]string{"token": token, "password": password})
+	}
+
+	// Unknown addresses get the same answer but no mail.
+	sent := len(ts.outbox.Messages())
+	forgot("nobody@breakingbad.com")
+	if n := len(ts.outbox.Messages()); n != sent {
+		t.Fatalf("expected no mail for an unknown address, got %d", n-sent)
+	}
+
+	forgot("walt@breakingbad.com")
+	if to := ts.outbox.Messages()[sent].To; to != "walt@breakingbad.com" {
+		t.Fatalf("mail sent to %q", to)
+	}
+	token := resetToken()
+
+	if rec := reset("not-a-token", "heisenberg"); rec.Code != http.StatusBadRequest || decode[problemDetails](t, rec).Code != "reset_token_invalid" {
+		t.Fatalf("unknown token: expected reset_token_invalid, got %d", rec.Code)
+	}
+	if rec := reset(token, "heisenberg"); rec.Code != http.StatusNoContent {
+		t.Fatalf("reset: expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := reset(token, "again"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("reusing the token: expected 400, got %d", rec.Code)
+	}
+
+	if rec := ts.do("POST", "/api/refresh", "Bearer "+walt.RefreshToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh after reset: expected 401, got %d", rec.Code)
+	}
+	if rec := ts.do("POST", "/api/login", "", login{Email: "walt@breakingbad.com", Password: "hunter2"}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("login with the old password: expected 401, got %d", rec.Code)
+	}
+	if rec := ts.do("POST", "/api/login", "", login{Email: "walt@breakingbad.com", Password: "heisenberg"}); rec.Code != http.StatusOK {
+		t.Fatalf("login with the new password: expected 200, got %d", rec.Code)
+	}
+
+	// A successful reset also voids the other tokens the user asked for.
+	forgot("walt@breakingbad.com")
+	older := resetToken()
+	forgot("walt@breakingbad.com")
+	if rec := reset(resetToken(), "saymyname"); rec.Code != http.StatusNoContent {
+		t.Fatalf("second reset: expected 204, got %d", rec.Code)
+	}
+	if rec := reset(older, "saymyname"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("older token after a reset: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	ts := newTestServer(t)
+	ts.cfg.requireVerifiedEmail = true
+	walt := ts.signup("walt@breakingbad.com")
+	ts.signup("skyler@breakingbad.com")
+
+	// verifyLink returns the path of the link in the last mail sent to email.
+	verifyLink := func(email string) string {
+		t.Helper()
+		ts.cfg.background.Wait()
+		messages := ts.outbox.Messages()
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].To != email {
+				continue
+			}
+			for _, line := range strings.Split(messages[i].Body, "\n") {
+				if path, ok := strings.CutPrefix(line, "http://chirpy.test"); ok {
+					return path
+				}
+			}
+		}
+		t.Fatalf("no verification link sent to %s", email)
+		return ""
+	}
+	post := func() int {
+		t.Helper()
+		return ts.do("POST", "/api/chirps", "Bearer "+walt.Token, map[string]any{"body": "say my name", "user_id": walt.ID}).Code
+	}
+	updateEmail := func(email string) *httptest.ResponseRecorder {
+		t.Helper()
+		return ts.do("PUT", "/api/users", "Bearer "+walt.RefreshToken, map[string]string{"email": email, "password": "hunter2"})
+	}
+
+	if walt.EmailVerified {
+		t.Fatalf("new account is already verified")
+	}
+	if code := post(); code != http.StatusForbidden {
+		t.Fatalf("posting unverified: expected 403, got %d", code)
+	}
+
+	link := verifyLink("walt@breakingbad.com")
+	rec := ts.do("GET", link, "", nil)
+	if rec.Code != http.StatusOK || !decode[UserResponse](t, rec).EmailVerified {
+		t.Fatalf("verify: expected a verified user, got %d", rec.Code)
+	}
+	if rec := ts.do("GET", link, "", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("reusing the link: expected 400, got %d", rec.Code)
+	}
+	if code := post(); code != http.StatusCreated {
+		t.Fatalf("posting verified: expected 201, got %d", code)
+	}
+	if rec := ts.do("POST", "/api/users/verification", "Bearer "+walt.Token, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("resend when verified: expected 409, got %d", rec.Code)
+	}
+
+	// Changing the email keeps the old one until the new one is confirmed.
+	if rec := updateEmail("skyler@breakingbad.com"); rec.Code != http.StatusConflict {
+		t.Fatalf("taken email: expected 409, got %d", rec.Code)
+	}
+	rec = updateEmail("heisenberg@breakingbad.com")
+	if user := decode[UserResponse](t, rec); user.Email != "walt@breakingbad.com" || user.PendingEmail != "heisenberg@breakingbad.com" {
+		t.Fatalf("unexpected user after email change %+v", user)
+	}
+	stale := verifyLink("heisenberg@breakingbad.com")
+	updateEmail("ww@breakingbad.com")
+	if rec := ts.do("GET", stale, "", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("link for a replaced address: expected 400, got %d", rec.Code)
+	}
+
+	if rec := ts.do("POST", "/api/users/verification", "Bearer "+walt.Token, nil); rec.Code != http.StatusAccepted {
+		t.Fatalf("resend: expected 202, got %d", rec.Code)
+	}
+	rec = ts.do("GET", verifyLink("ww@breakingbad.com"), "", nil)
+	if user := decode[UserResponse](t, rec); user.Email != "ww@breakingbad.com" || user.PendingEmail != "" || !user.EmailVerified {
+		t.Fatalf("unexpected user after confirming %+v", user)
+	}
+	if rec := ts.do("POST", "/api/login", "", login{Email: "ww@breakingbad.com", Password: "hunter2"}); rec.Code != http.StatusOK {
+		t.Fatalf("login with the new email: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	bearer := "Bearer " + walt.Token
+	creds := login{Email: "walt@breakingbad.com", Password: "hunter2"}
+
+	if rec := ts.do("POST", "/api/users/me/2fa/enable", bearer, map[string]string{"code": "123456"}); rec.Code != http.StatusConflict {
+		t.Fatalf("enable before setup: expected 409, got %d", rec.Code)
+	}
+
+	rec := ts.do("POST", "/api/users/me/2fa/setup", bearer, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("setup: expected 200, got %d", rec.Code)
+	}
+	setup := decode[struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}](t, rec)
+	if !strings.HasPrefix(setup.OtpauthURI, "otpauth://totp/Chirpy:") {
+		t.Fatalf("unexpected otpauth uri %q", setup.OtpauthURI)
+	}
+
+	// Until 2FA is enabled the password alone still logs in.
+	if user := decode[UserResponse](t, ts.do("POST", "/api/login", "", creds)); user.Token == "" || user.TwoFactor {
+		t.Fatalf("login before enabling: unexpected %+v", user)
+	}
+
+	code := func(offset time.Duration) string {
+		t.Helper()
+		c, err := auth.TOTPCode(setup.Secret, time.Now().Add(offset))
+		if err != nil {
+			t.Fatalf("TOTPCode returned error: %v", err)
+		}
+		return c
+	}
+
+	if rec := ts.do("POST", "/api/users/me/2fa/enable", bearer, map[string]string{"code": "000000"}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("enable with a wrong code: expected 401, got %d", rec.Code)
+	}
+	rec = ts.do("POST", "/api/users/me/2fa/enable", bearer, map[string]string{"code": code(0)})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	recoveryCodes := decode[struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}](t, rec).RecoveryCodes
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %d", len(recoveryCodes))
+	}
+	if rec := ts.do("POST", "/api/users/me/2fa/setup", bearer, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("setup when enabled: expected 409, got %d", rec.Code)
+	}
+
+	challenge := func() string {
+		t.Helper()
+		rec := ts.do("POST", "/api/login", "", creds)
+		res := decode[MFAChallengeResponse](t, rec)
+		if rec.Code != http.StatusOK || !res.MFARequired || res.MFAToken == "" {
+			t.Fatalf("login: expected an mfa challenge, got %d %+v", rec.Code, res)
+		}
+		return res.MFAToken
+	}
+	secondFactor := func(body map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		return ts.do("POST", "/api/login/2fa", "", body)
+	}
+
+	mfaToken := challenge()
+	if rec := ts.do("GET", "/api/users/me/mentions", "Bearer "+mfaToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("mfa token as an access token: expected 401, got %d", rec.Code)
+	}
+
+	// The code used to enable 2FA can't be replayed, the next one works.
+	if rec := secondFactor(map[string]string{"mfa_token": mfaToken, "code": code(0)}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed code: expected 401, got %d", rec.Code)
+	}
+	rec = secondFactor(map[string]string{"mfa_token": mfaToken, "code": code(30 * time.Second)})
+	if user := decode[UserResponse](t, rec); rec.Code != http.StatusOK || user.Token == "" || user.RefreshToken == "" || !user.TwoFactor {
+		t.Fatalf("second factor: expected a session, got %d %+v", rec.Code, user)
+	}
+
+	if rec := secondFactor(map[string]string{"mfa_token": walt.Token, "code": code(60 * time.Second)}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("access token as an mfa token: expected 401, got %d", rec.Code)
+	}
+
+	// Recovery codes work once each.
+	mfaToken = challenge()
+	recovery := map[string]string{"mfa_token": mfaToken, "recovery_code": strings.ToUpper(recoveryCodes[3])}
+	if rec := secondFactor(recovery); rec.Code != http.StatusOK {
+		t.Fatalf("recovery code: expected 200, got %d", rec.Code)
+	}
+	if rec := secondFactor(recovery); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("reused recovery code: expected 401, got %d", rec.Code)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t)
+	laptop := ts.signup("walt@breakingbad.com")
+
+	login := func(password, device string) UserResponse {
+		t.Helper()
+		rec := ts.do("POST", "/api/login", "", map[string]string{"email": "walt@breakingbad.com", "password": password, "device_name": device})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login: got status %d: %s", rec.Code, rec.Body)
+		}
+		return decode[UserResponse](t, rec)
+	}
+	sessions := func() []SessionResponse {
+		t.Helper()
+		rec := ts.do("GET", "/api/users/me/sessions", "Bearer "+laptop.Token, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list sessions: got status %d: %s", rec.Code, rec.Body)
+		}
+		return decode[[]SessionResponse](t, rec)
+	}
+	canRefresh := func(user UserResponse) bool {
+		t.Helper()
+		return ts.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil).Code == http.StatusOK
+	}
+
+	phone := login("hunter2", "Walt's phone")
+
+	// Refreshing rotates the token but stays in the same session.
+	rec := ts.do("POST", "/api/refresh", "Bearer "+phone.RefreshToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: got status %d: %s", rec.Code, rec.Body)
+	}
+	phone.RefreshToken = decode[refreshResponse](t, rec).RefreshToken
+
+	list := sessions()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", list)
+	}
+	var phoneSession SessionResponse
+	for _, s := range list {
+		if s.IP != "192.0.2.1" {
+			t.Fatalf("expected the client address to be recorded, got %+v", s)
+		}
+		if s.DeviceName == "Walt's phone" {
+			phoneSession = s
+		} else if !s.Current {
+			t.Fatalf("expected the laptop session to be current, got %+v", s)
+		}
+	}
+	if phoneSession.ID == uuid.Nil || phoneSession.Current {
+		t.Fatalf("expected the phone session to keep its name across refreshes, got %+v", list)
+	}
+
+	if rec := ts.do("DELETE", "/api/users/me/sessions/"+phoneSession.ID.String(), "Bearer "+laptop.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete session: got status %d: %s", rec.Code, rec.Body)
+	}
+	if canRefresh(phone) {
+		t.Fatalf("expected the deleted session to be signed out")
+	}
+	if rec := ts.do("DELETE", "/api/users/me/sessions/"+phoneSession.ID.String(), "Bearer "+laptop.Token, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a signed out session, got %d", rec.Code)
+	}
+
+	// Other users' sessions can't be signed out.
+	other := ts.signup("jesse@breakingbad.com")
+	otherSessions := decode[[]SessionResponse](t, ts.do("GET", "/api/users/me/sessions", "Bearer "+other.Token, nil))
+	if rec := ts.do("DELETE", "/api/users/me/sessions/"+otherSessions[0].ID.String(), "Bearer "+laptop.Token, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another user's session, got %d", rec.Code)
+	}
+
+	tablet := login("hunter2", "")
+	if rec := ts.do("POST", "/api/users/me/sessions/revoke-others", "Bearer "+laptop.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke others: got status %d: %s", rec.Code, rec.Body)
+	}
+	if canRefresh(tablet) {
+		t.Fatalf("expected other sessions to be signed out")
+	}
+	if len(sessions()) != 1 {
+		t.Fatalf("expected only the current session to be left")
+	}
+
+	// Changing the password can sign out everywhere else too.
+	desktop := login("hunter2", "desktop")
+	body := map[string]any{"email": "walt@breakingbad.com", "password": "heisenberg", "revoke_other_sessions": true}
+	rec = ts.do("PUT", "/api/users", "Bearer "+laptop.RefreshToken, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update password: got status %d: %s", rec.Code, rec.Body)
+	}
+	if canRefresh(desktop) {
+		t.Fatalf("expected the password change to sign out other sessions")
+	}
+	if !canRefresh(laptop) {
+		t.Fatalf("expected the session that changed the password to stay signed in")
+	}
+
+	if rec := ts.do("POST", "/api/login", "", map[string]string{"email": "walt@breakingbad.com", "password": "hunter2", "device_name": strings.Repeat("x", 65)}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a long device name, got %d", rec.Code)
+	}
+}
+
+func TestLoginThrottling(t *testing.T) {
+	ts := newTestServer(t)
+	walt := ts.signup("walt@breakingbad.com")
+	gus := ts.signupWithRole("gus@lospollos.com", auth.RoleAdmin)
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		t.Helper()
+		return ts.do("POST", "/api/login", "", map[string]string{"email": email, "password": password})
+	}
+	failures := 0
+	fail := func(email string) {
+		t.Helper()
+		failures++
+		if rec := login(email, "wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failed login %d: expected 401, got %d", failures, rec.Code)
+		}
+	}
+
+	for range accountThrottle.freeAttempts {
+		fail("walt@breakingbad.com")
+	}
+
+	// Locked accounts are refused even with the right password.
+	rec := login("walt@breakingbad.com", "hunter2")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for a locked account, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected Retry-After: 30, got %q", rec.Header().Get("Retry-After"))
+	}
+	if problem := decode[problemDetails](t, rec); problem.Code != "too_many_logins" {
+		t.Fatalf("expected too_many_logins, got %q", problem.Code)
+	}
+
+	unlock := "/admin/users/" + walt.ID.String() + "/unlock"
+	if rec := ts.do("POST", unlock, "Bearer "+walt.Token, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("unlock as user: expected 403, got %d", rec.Code)
+	}
+	if rec := ts.do("POST", unlock, "Bearer "+gus.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unlock as admin: got status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := login("walt@breakingbad.com", "hunter2"); rec.Code != http.StatusOK {
+		t.Fatalf("login after unlock: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Unknown emails lock out the same way, so a 429 doesn't reveal
+	// whether an account exists.
+	for range accountThrottle.freeAttempts {
+		fail("saul@goodman.com")
+	}
+	if rec := login("saul@goodman.com", "wrong"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for a locked unknown email, got %d", rec.Code)
+	}
+
+	// Spreading attempts over many emails runs into the address limit.
+	for i := failures; i < int(ipThrottle.freeAttempts); i++ {
+		fail(fmt.Sprintf("user%d@breakingbad.com", i))
+	}
+	if rec := login("walt@breakingbad.com", "hunter2"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for a locked address, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// UserProfileResponse is what anyone can see about a user. It leaves out
+// the email address, which only the user themselves gets back.
+type UserProfileResponse struct {
+	ID             uuid.UUID `json:"id"`
+	Handle         string    `json:"handle,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+}
+
+func userToProfile(u database.User, followers int64, following int64) UserProfileResponse {
+	return UserProfileResponse{
+		ID:             u.ID,
+		Handle:         u.Handle.String,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+		FollowerCount:  followers,
+		FollowingCount: following,
+	}
+}
+
+type FollowResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Handle     string    `json:"handle,omitempty"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// pathUser resolves the {userID} path value to an existing user. On failure
+// the error response has already been sent.
+func (cfg *apiConfig) pathUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		requestLogger(r).Info("transforming uuid", "err", err)
+		respondWithError(w, errUserNotFound)
+		return database.User{}, false
+	}
+
+	user, err := cfg.queries.GetUserWithId(r.Context(), id)
+	if err != nil {
+		requestLogger(r).Info("getting user", "err", err)
+		respondWithError(w, errUserNotFound)
+		return database.User{}, false
+	}
+
+	return user, true
+}
+
+func (cfg *apiConfig) get_userEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	followers, err := cfg.queries.CountFollowers(r.Context(), user.ID)
+	if err != nil {
+		requestLogger(r).Error("counting followers", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	following, err := cfg.queries.CountFollowing(r.Context(), user.ID)
+	if err != nil {
+		requestLogger(r).Error("counting following", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userToProfile(user, followers, following))
+}
+
+func (cfg *apiConfig) followEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.canInteract(w, r, user_id) {
+		return
+	}
+
+	followee, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	if followee.ID == user_id {
+		respondWithError(w, errFollowSelf)
+		return
+	}
+
+	err := cfg.queries.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: user_id,
+		FolloweeID: followee.ID,
+	})
+	if err != nil {
+		requestLogger(r).Error("following user", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unfollowEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	followee, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.queries.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: user_id,
+		FolloweeID: followee.ID,
+	})
+	if err != nil {
+		requestLogger(r).Error("unfollowing user", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) get_followersEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	rows, err := cfg.queries.ListFollowers(r.Context(), database.ListFollowersParams{
+		UserID:          user.ID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("listing followers", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	followers := make([]FollowResponse, 0, len(rows))
+	for _, row := range rows {
+		followers = append(followers, FollowResponse{ID: row.ID, Handle: row.Handle.String, FollowedAt: row.FollowedAt})
+	}
+
+	if len(followers) > 0 {
+		last := followers[len(followers)-1]
+		setNextLink(w, r, page, len(followers), pageCursor{CreatedAt: last.FollowedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, followers)
+}
+
+func (cfg *apiConfig) get_followingEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	rows, err := cfg.queries.ListFollowing(r.Context(), database.ListFollowingParams{
+		UserID:          user.ID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("listing following", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	following := make([]FollowResponse, 0, len(rows))
+	for _, row := range rows {
+		following = append(following, FollowResponse{ID: row.ID, Handle: row.Handle.String, FollowedAt: row.FollowedAt})
+	}
+
+	if len(following) > 0 {
+		last := following[len(following)-1]
+		setNextLink(w, r, page, len(following), pageCursor{CreatedAt: last.FollowedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, following)
+}
+
+func (cfg *apiConfig) get_timelineEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	chirps, err := cfg.queries.GetTimeline(r.Context(), database.GetTimelineParams{
+		FollowerID:      user_id,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("getting timeline", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	res := chirpsToResponse(chirps)
+	if err := cfg.setViewerState(r.Context(), uuid.NullUUID{UUID: user_id, Valid: true}, chirpRefs(res)...); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	if len(chirps) > 0 {
+		last := chirps[len(chirps)-1]
+		setNextLink(w, r, page, len(chirps), pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
@@ -2,11 +2,13 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alexedwards/argon2id"
@@ -22,13 +24,104 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn).UTC()),
-		Subject:   userID.String(),
-	})
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := HashPassword("chirpy dummy password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// CheckDummyPasswordHash does the work of CheckPasswordHash against a hash
+// that never matches. Logins for unknown emails use it so they take as long
+// as a wrong password for a registered one.
+func CheckDummyPasswordHash(password string) {
+	argon2id.ComparePasswordAndHash(password, dummyHash())
+}
+
+// Role is what a user is allowed to do. Each role includes the ones below
+// it: admins can do everything moderators can.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, expected user, moderator or admin", s)
+	}
+	return role, nil
+}
+
+// Includes reports whether r grants everything required does.
+func (r Role) Includes(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
+
+// ScopeMFAPending marks a token issued after the password was checked but
+// before the second factor was. It is only good for finishing the login.
+const ScopeMFAPending = "mfa_pending"
+
+// Claims are the claims of a chirpy token. UserID is parsed from the
+// subject and SessionID from the sid claim, which names the refresh token
+// family the token was issued for. Access tokens have no scope; a scoped
+// token is only accepted by ParseScopedJWT.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role    Role   `json:"role,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+	Session string `json:"sid,omitempty"`
+
+	UserID    uuid.UUID `json:"-"`
+	SessionID uuid.UUID `json:"-"`
+}
+
+// JWTOption adds a claim to a token made by MakeJWT.
+type JWTOption func(*Claims)
+
+func WithRole(role Role) JWTOption {
+	return func(c *Claims) {
+		c.Role = role
+	}
+}
+
+func WithScope(scope string) JWTOption {
+	return func(c *Claims) {
+		c.Scope = scope
+	}
+}
+
+func WithSession(sessionID uuid.UUID) JWTOption {
+	return func(c *Claims) {
+		c.Session = sessionID.String()
+	}
+}
+
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, opts ...JWTOption) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn).UTC()),
+			Subject:   userID.String(),
+		},
+	}
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	r, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
@@ -39,59 +132,112 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (any, error) {
+	claims, err := ParseJWT(tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+// ParseJWT validates an access token and returns its claims. Tokens issued
+// before roles existed carry no role claim and get RoleUser.
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
+	return ParseScopedJWT(tokenString, tokenSecret, "")
+}
+
+// ParseScopedJWT is ParseJWT for tokens made WithScope(scope).
+func ParseScopedJWT(tokenString, tokenSecret, scope string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (any, error) {
 		if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %s", t.Method.Alg())
 		}
 		return []byte(tokenSecret), nil
 	})
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid token: %w", err)
+		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
 	if !token.Valid {
-		return uuid.Nil, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	claims, ok := token.Claims.(*Claims)
 	if !ok {
-		return uuid.Nil, fmt.Errorf("invalid claims type")
+		return nil, fmt.Errorf("invalid claims type")
 	}
 
 	if claims.Issuer != "chirpy" {
-		return uuid.Nil, fmt.Errorf("unexpected issuer: %q", claims.Issuer)
+		return nil, fmt.Errorf("unexpected issuer: %q", claims.Issuer)
 	}
 	if claims.ExpiresAt == nil || time.Until(claims.ExpiresAt.Time) <= 0 {
-		return uuid.Nil, fmt.Errorf("token expired")
+		return nil, fmt.Errorf("token expired")
 	}
 
 	if claims.Subject == "" {
-		return uuid.Nil, fmt.Errorf("missing subject claim")
+		return nil, fmt.Errorf("missing subject claim")
 	}
 
 	uid, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid subject uuid: %w", err)
+		return nil, fmt.Errorf("invalid subject uuid: %w", err)
+	}
+	claims.UserID = uid
+
+	if claims.Session != "" {
+		sid, err := uuid.Parse(claims.Session)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session uuid: %w", err)
+		}
+		claims.SessionID = sid
+	}
+
+	if claims.Scope != scope {
+		return nil, fmt.Errorf("unexpected token scope: %q", claims.Scope)
+	}
+
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+	if _, err := ParseRole(string(claims.Role)); err != nil {
+		return nil, err
 	}
 
-	return uid, nil
+	return claims, nil
 }
 
+// GetBearerToken returns the token from an "Authorization: Bearer <token>"
+// header.
 func GetBearerToken(headers http.Header) (string, error) {
 	val := headers.Get("Authorization")
 	if val == "" {
 		return "", errors.New("Header doesn't contain bearer")
 	}
-	strings := strings.Fields(val)
-	if len(strings) < 2 {
+
+	fields := strings.Fields(val)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "Bearer") {
+		return "", errors.New("Header contains invalid values")
+	}
+
+	return fields[1], nil
+}
+
+// GetAPIKey returns the key from an "Authorization: ApiKey <key>" header.
+func GetAPIKey(headers http.Header) (string, error) {
+	val := headers.Get("Authorization")
+	if val == "" {
+		return "", errors.New("Header doesn't contain api key")
+	}
+
+	fields := strings.Fields(val)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "ApiKey") {
 		return "", errors.New("Header contains invalid values")
 	}
 
-	return strings[1], nil
+	return fields[1], nil
 }
 
 func MakeRefreshToken() (string, error) {
-	var rand_bytes []byte
+	rand_bytes := make([]byte, 32)
 	_, err := rand.Read(rand_bytes)
 	if err != nil {
 		return "", errors.New("Error while creating random bytes")
@@ -99,3 +245,10 @@ func MakeRefreshToken() (string, error) {
 
 	return hex.EncodeToString(rand_bytes), nil
 }
+
+// HashToken hashes a random token for storage. The tokens carry 256 bits of
+// entropy, so a plain SHA-256 is enough and keeps lookups by hash possible.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,7 +1,13 @@
 package auth
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -134,6 +140,117 @@ func TestJWT_MalformedTokenIsRejected(t *testing.T) {
 	}
 }
 
+func TestJWT_Role(t *testing.T) {
+	secret := "role-secret-0123456789"
+	uid := uuid.New()
+
+	token, err := MakeJWT(uid, secret, 5*time.Minute, WithRole(RoleModerator))
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	claims, err := ParseJWT(token, secret)
+	if err != nil {
+		t.Fatalf("ParseJWT returned error: %v", err)
+	}
+	if claims.UserID != uid || claims.Role != RoleModerator {
+		t.Fatalf("got user %v with role %q, want %v with %q", claims.UserID, claims.Role, uid, RoleModerator)
+	}
+
+	token, err = MakeJWT(uid, secret, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	claims, err = ParseJWT(token, secret)
+	if err != nil {
+		t.Fatalf("ParseJWT returned error: %v", err)
+	}
+	if claims.Role != RoleUser {
+		t.Fatalf("token without a role claim got role %q, want %q", claims.Role, RoleUser)
+	}
+
+	token, err = MakeJWT(uid, secret, 5*time.Minute, WithRole("superuser"))
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	if _, err := ParseJWT(token, secret); err == nil {
+		t.Fatalf("ParseJWT accepted an unknown role")
+	}
+}
+
+func TestJWT_Scope(t *testing.T) {
+	secret := "scope-secret-0123456789"
+	uid := uuid.New()
+
+	token, err := MakeJWT(uid, secret, 5*time.Minute, WithScope(ScopeMFAPending))
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	if _, err := ParseJWT(token, secret); err == nil {
+		t.Fatalf("ParseJWT accepted a scoped token as an access token")
+	}
+	claims, err := ParseScopedJWT(token, secret, ScopeMFAPending)
+	if err != nil || claims.UserID != uid {
+		t.Fatalf("ParseScopedJWT: got %+v, %v", claims, err)
+	}
+
+	access, err := MakeJWT(uid, secret, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	if _, err := ParseScopedJWT(access, secret, ScopeMFAPending); err == nil {
+		t.Fatalf("ParseScopedJWT accepted an access token")
+	}
+}
+
+func TestJWT_Session(t *testing.T) {
+	secret := "session-secret-0123456789"
+	uid := uuid.New()
+	sid := uuid.New()
+
+	token, err := MakeJWT(uid, secret, 5*time.Minute, WithSession(sid))
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	claims, err := ParseJWT(token, secret)
+	if err != nil {
+		t.Fatalf("ParseJWT returned error: %v", err)
+	}
+	if claims.SessionID != sid {
+		t.Fatalf("got session %v, want %v", claims.SessionID, sid)
+	}
+
+	token, err = MakeJWT(uid, secret, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	claims, err = ParseJWT(token, secret)
+	if err != nil {
+		t.Fatalf("ParseJWT returned error: %v", err)
+	}
+	if claims.SessionID != uuid.Nil {
+		t.Fatalf("token without a sid claim got session %v", claims.SessionID)
+	}
+}
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role, required Role
+		want           bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleModerator, RoleUser, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, RoleModerator, false},
+		{"superuser", RoleUser, false},
+	}
+	for _, tc := range tests {
+		if got := tc.role.Includes(tc.required); got != tc.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", tc.role, tc.required, got, tc.want)
+		}
+	}
+}
+
 func TestGetBearerToken(t *testing.T) {
 	head := http.Header{}
 	_, err := GetBearerToken(head)
@@ -141,9 +258,202 @@ func TestGetBearerToken(t *testing.T) {
 		t.Fatalf("Error validating header without auth")
 	}
 
-	head.Add("Authorization", "something")
+	head.Set("Authorization", "something")
 	_, err = GetBearerToken(head)
-	if err != nil {
+	if err == nil {
+		t.Fatalf("Error validating header without a scheme")
+	}
+
+	head.Set("Authorization", "ApiKey something")
+	_, err = GetBearerToken(head)
+	if err == nil {
+		t.Fatalf("Error validating header with another scheme")
+	}
+
+	head.Set("Authorization", "Bearer something")
+	token, err := GetBearerToken(head)
+	if err != nil || token != "something" {
 		t.Fatalf("Error validating header with auth")
 	}
 }
+
+func TestGetAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"missing", "", "", true},
+		{"valid", "ApiKey f271c81ff7084ee5b99a5091b42d486e", "f271c81ff7084ee5b99a5091b42d486e", false},
+		{"case insensitive scheme", "apikey abc", "abc", false},
+		{"bearer scheme", "Bearer abc", "", true},
+		{"no key", "ApiKey", "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			head := http.Header{}
+			if tc.value != "" {
+				head.Set("Authorization", tc.value)
+			}
+
+			got, err := GetAPIKey(head)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error for %q, got key %q", tc.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetAPIKey returned error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("GetAPIKey returned %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMakeRefreshToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken returned error: %v", err)
+	}
+	if len(token) != 64 {
+		t.Fatalf("expected a 64 character hex token, got %q", token)
+	}
+
+	token2, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("second MakeRefreshToken returned error: %v", err)
+	}
+	if token == token2 {
+		t.Fatalf("expected different refresh tokens, got identical")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken returned error: %v", err)
+	}
+
+	hash := HashToken(token)
+	if hash == token || len(hash) != 64 {
+		t.Fatalf("expected a 64 character hash different from the token, got %q", hash)
+	}
+	if HashToken(token) != hash {
+		t.Fatalf("expected HashToken to be deterministic")
+	}
+}
+
+// The test vectors from RFC 6238 appendix B. Each algorithm uses the ASCII
+// seed "12345678901234567890" repeated to its block size.
+func TestTOTP_RFC6238Vectors(t *testing.T) {
+	seeds := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	hashes := map[string]func() hash.Hash{
+		"SHA1":   sha1.New,
+		"SHA256": sha256.New,
+		"SHA512": sha512.New,
+	}
+
+	vectors := []struct {
+		unix int64
+		mode string
+		want string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, v := range vectors {
+		got := hotp(seeds[v.mode], totpCounter(time.Unix(v.unix, 0)), 8, hashes[v.mode])
+		if got != v.want {
+			t.Errorf("%s at %d: got %s, want %s", v.mode, v.unix, got, v.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret returned error: %v", err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode returned error: %v", err)
+	}
+	if len(code) != 6 {
+		t.Fatalf("expected a 6 digit code, got %q", code)
+	}
+
+	counter, ok := ValidateTOTP(secret, code, now)
+	if !ok || counter != now.Unix()/30 {
+		t.Fatalf("expected the current code to validate at counter %d, got %d, %v", now.Unix()/30, counter, ok)
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(30*time.Second)); !ok {
+		t.Fatalf("expected a code from the previous period to validate")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(90*time.Second)); ok {
+		t.Fatalf("expected a code from three periods ago to be rejected")
+	}
+	if _, ok := ValidateTOTP("not base32!", code, now); ok {
+		t.Fatalf("expected a malformed secret to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "Chirpy", "walt@breakingbad.com")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", uri, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Chirpy:walt@breakingbad.com" {
+		t.Fatalf("unexpected uri %q", uri)
+	}
+	if q := u.Query(); q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Chirpy" {
+		t.Fatalf("unexpected query in %q", uri)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes returned error: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || strings.Index(code, "-") != 5 {
+			t.Fatalf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
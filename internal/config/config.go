@@ -0,0 +1,463 @@
+// Package config loads chirpy's settings into a single struct.
+//
+// Each layer overrides the one before it: built-in defaults, an optional YAML
+// file, environment variables and finally command-line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+type Config struct {
+	Platform string `yaml:"platform"`
+	Secret   string `yaml:"secret"`
+	PolkaKey string `yaml:"polka_key"`
+	// PublicURL is where clients reach the server. Links in emails point
+	// there.
+	PublicURL string `yaml:"public_url"`
+	// RequireVerifiedEmail stops accounts from posting chirps until their
+	// email address is verified.
+	RequireVerifiedEmail bool           `yaml:"require_verified_email"`
+	Database             DatabaseConfig `yaml:"database"`
+	Server               ServerConfig   `yaml:"server"`
+	Log                  LogConfig      `yaml:"log"`
+
+	Moderation ModerationConfig `yaml:"moderation"`
+	Mail       MailConfig       `yaml:"mail"`
+}
+
+type DatabaseConfig struct {
+	Backend     string `yaml:"backend"`
+	URL         string `yaml:"url"`
+	AutoMigrate bool   `yaml:"auto_migrate"`
+}
+
+type ServerConfig struct {
+	Addr              string        `yaml:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+	TLSCertFile       string        `yaml:"tls_cert_file"`
+	TLSKeyFile        string        `yaml:"tls_key_file"`
+}
+
+type ModerationConfig struct {
+	// RulesFile replaces the built-in word list. Rules added through the
+	// admin API apply on top of it.
+	RulesFile string `yaml:"rules_file"`
+}
+
+type MailConfig struct {
+	// Backend is smtp or outbox. The outbox doesn't deliver anything: mail
+	// is kept in memory and, with OutboxDir set, written there as files.
+	Backend      string `yaml:"backend"`
+	From         string `yaml:"from"`
+	OutboxDir    string `yaml:"outbox_dir"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// SlogLevel returns the configured level, falling back to info when it
+// doesn't parse. Validate reports unparseable levels.
+func (c LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+func Default() Config {
+	return Config{
+		Platform:  "production",
+		PublicURL: "http://localhost:8080",
+		Database: DatabaseConfig{
+			Backend: "postgres",
+		},
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Mail: MailConfig{
+			Backend:  "outbox",
+			From:     "chirpy@localhost",
+			SMTPPort: 587,
+		},
+	}
+}
+
+// setting is a value that can come from both the environment and a flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"PLATFORM", "platform", "deployment platform: dev or production", func(c *Config, v string) error {
+		c.Platform = v
+		return nil
+	}},
+	{"SECRET", "secret", "HMAC secret used to sign access tokens", func(c *Config, v string) error {
+		c.Secret = v
+		return nil
+	}},
+	{"POLKA_KEY", "polka-key", "API key expected on Polka webhooks", func(c *Config, v string) error {
+		c.PolkaKey = v
+		return nil
+	}},
+	{"PUBLIC_URL", "public-url", "URL clients reach the server at, used in email links", func(c *Config, v string) error {
+		c.PublicURL = v
+		return nil
+	}},
+	{"REQUIRE_VERIFIED_EMAIL", "require-verified-email", "only let accounts with a verified email post chirps", func(c *Config, v string) error {
+		return setBool(&c.RequireVerifiedEmail, v)
+	}},
+	{"DB_BACKEND", "db-backend", "storage backend: postgres or memory", func(c *Config, v string) error {
+		c.Database.Backend = v
+		return nil
+	}},
+	{"DB_URL", "db-url", "PostgreSQL connection URL", func(c *Config, v string) error {
+		c.Database.URL = v
+		return nil
+	}},
+	{"AUTO_MIGRATE", "auto-migrate", "apply pending migrations on startup", func(c *Config, v string) error {
+		return setBool(&c.Database.AutoMigrate, v)
+	}},
+	{"ADDR", "addr", "address to listen on", func(c *Config, v string) error {
+		c.Server.Addr = v
+		return nil
+	}},
+	{"READ_TIMEOUT", "read-timeout", "maximum duration for reading a request", func(c *Config, v string) error {
+		return setDuration(&c.Server.ReadTimeout, v)
+	}},
+	{"READ_HEADER_TIMEOUT", "read-header-timeout", "maximum duration for reading request headers", func(c *Config, v string) error {
+		return setDuration(&c.Server.ReadHeaderTimeout, v)
+	}},
+	{"WRITE_TIMEOUT", "write-timeout", "maximum duration for writing a response", func(c *Config, v string) error {
+		return setDuration(&c.Server.WriteTimeout, v)
+	}},
+	{"IDLE_TIMEOUT", "idle-timeout", "how long keep-alive connections stay idle", func(c *Config, v string) error {
+		return setDuration(&c.Server.IdleTimeout, v)
+	}},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long to drain requests on shutdown", func(c *Config, v string) error {
+		return setDuration(&c.Server.ShutdownTimeout, v)
+	}},
+	{"MAX_HEADER_BYTES", "max-header-bytes", "maximum size of request headers", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		c.Server.MaxHeaderBytes = n
+		return nil
+	}},
+	{"TLS_CERT_FILE", "tls-cert-file", "TLS certificate file", func(c *Config, v string) error {
+		c.Server.TLSCertFile = v
+		return nil
+	}},
+	{"TLS_KEY_FILE", "tls-key-file", "TLS private key file", func(c *Config, v string) error {
+		c.Server.TLSKeyFile = v
+		return nil
+	}},
+	{"MODERATION_RULES_FILE", "moderation-rules-file", "YAML file with chirp moderation rules", func(c *Config, v string) error {
+		c.Moderation.RulesFile = v
+		return nil
+	}},
+	{"MAIL_BACKEND", "mail-backend", "how mail is sent: smtp or outbox", func(c *Config, v string) error {
+		c.Mail.Backend = v
+		return nil
+	}},
+	{"MAIL_FROM", "mail-from", "sender address of outgoing mail", func(c *Config, v string) error {
+		c.Mail.From = v
+		return nil
+	}},
+	{"MAIL_OUTBOX_DIR", "mail-outbox-dir", "directory the outbox writes mail to", func(c *Config, v string) error {
+		c.Mail.OutboxDir = v
+		return nil
+	}},
+	{"SMTP_HOST", "smtp-host", "SMTP relay host", func(c *Config, v string) error {
+		c.Mail.SMTPHost = v
+		return nil
+	}},
+	{"SMTP_PORT", "smtp-port", "SMTP relay port", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		c.Mail.SMTPPort = n
+		return nil
+	}},
+	{"SMTP_USERNAME", "smtp-username", "SMTP username, unset disables auth", func(c *Config, v string) error {
+		c.Mail.SMTPUsername = v
+		return nil
+	}},
+	{"SMTP_PASSWORD", "smtp-password", "SMTP password", func(c *Config, v string) error {
+		c.Mail.SMTPPassword = v
+		return nil
+	}},
+	{"LOG_LEVEL", "log-level", "minimum log level: debug, info, warn or error", func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"LOG_FORMAT", "log-format", "log output format: json or text", func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return errors.New("must be true or false")
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *time.Duration, v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return errors.New("must be a duration such as 30s")
+	}
+	*dst = d
+	return nil
+}
+
+// Load builds the effective configuration from args (without the program
+// name) and returns the arguments left after the flags.
+func Load(args []string, stderr io.Writer) (Config, []string, error) {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFile := fs.String("config", os.Getenv("CHIRPY_CONFIG"), "YAML config file")
+	for _, s := range settings {
+		fs.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := Default()
+
+	if *configFile != "" {
+		if err := loadFile(&cfg, *configFile); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		v, ok := os.LookupEnv(s.env)
+		if !ok || v == "" {
+			continue
+		}
+		if err := s.set(&cfg, v); err != nil {
+			return Config{}, nil, fmt.Errorf("%s %w", s.env, err)
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag != f.Name || flagErr != nil {
+				continue
+			}
+			if err := s.set(&cfg, f.Value.String()); err != nil {
+				flagErr = fmt.Errorf("-%s %w", s.flag, err)
+			}
+		}
+	})
+	if flagErr != nil {
+		return Config{}, nil, flagErr
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Validate rejects configurations the server can't safely run with.
+func (c Config) Validate() error {
+	var errs []error
+
+	switch c.Platform {
+	case "dev", "production":
+	default:
+		errs = append(errs, fmt.Errorf("unknown platform %q, expected dev or production", c.Platform))
+	}
+
+	if strings.TrimSpace(c.Secret) == "" {
+		errs = append(errs, errors.New("secret must be set, an empty secret would sign tokens with an empty key"))
+	}
+
+	if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("public url %q must be an absolute http or https URL", c.PublicURL))
+	}
+
+	switch c.Database.Backend {
+	case "postgres":
+		if c.Database.URL == "" {
+			errs = append(errs, errors.New("database url must be set for the postgres backend"))
+		}
+	case "memory":
+		if c.Database.AutoMigrate {
+			errs = append(errs, errors.New("auto_migrate needs the postgres backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown database backend %q, expected postgres or memory", c.Database.Backend))
+	}
+
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls_cert_file and tls_key_file must be set together"))
+	}
+
+	if c.Server.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("max_header_bytes must be positive"))
+	}
+
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read_timeout", c.Server.ReadTimeout},
+		{"read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"write_timeout", c.Server.WriteTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+		{"shutdown_timeout", c.Server.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", t.name))
+		}
+	}
+
+	switch c.Mail.Backend {
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("smtp_host must be set for the smtp mail backend"))
+		}
+		if c.Mail.SMTPPort <= 0 || c.Mail.SMTPPort > 65535 {
+			errs = append(errs, fmt.Errorf("smtp_port %d is out of range", c.Mail.SMTPPort))
+		}
+	case "outbox":
+	default:
+		errs = append(errs, fmt.Errorf("unknown mail backend %q, expected smtp or outbox", c.Mail.Backend))
+	}
+	if !strings.Contains(c.Mail.From, "@") {
+		errs = append(errs, fmt.Errorf("mail from %q is not an email address", c.Mail.From))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", c.Log.Level))
+	}
+
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log format %q, expected json or text", c.Log.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy that is safe to print.
+func (c Config) Redacted() Config {
+	if c.Secret != "" {
+		c.Secret = redacted
+	}
+	if c.PolkaKey != "" {
+		c.PolkaKey = redacted
+	}
+	if c.Mail.SMTPPassword != "" {
+		c.Mail.SMTPPassword = redacted
+	}
+	if c.Database.URL != "" {
+		c.Database.URL = redactDatabaseURL(c.Database.URL)
+	}
+	return c
+}
+
+// dsnPassword matches the password in a key=value connection string, quoted
+// or not.
+var dsnPassword = regexp.MustCompile(`(?i)\bpassword\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactDatabaseURL hides the password in either form lib/pq accepts: a
+// postgres:// URL, where it can sit in the user info or the query string,
+// or a key=value connection string.
+func redactDatabaseURL(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return redacted
+	}
+	if u.Scheme == "" {
+		return dsnPassword.ReplaceAllString(dsn, "password="+redacted)
+	}
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return redacted
+	}
+	for key := range q {
+		if strings.EqualFold(key, "password") {
+			q[key] = []string{redacted}
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.Redacted()
+}
+
+// Print writes the configuration as YAML with secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
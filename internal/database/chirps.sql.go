@@ -7,26 +7,44 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
+WITH parent AS (
+    UPDATE
+        chirps
+    SET
+        reply_count = reply_count + 1
+    WHERE
+        id = $1
+)
 INSERT INTO
-    chirps (id, body, user_id, created_at, updated_at)
+    chirps (id, body, user_id, created_at, updated_at, in_reply_to)
 VALUES
-    (gen_random_uuid(), $1, $2, NOW(), NOW())
+    (
+        gen_random_uuid(),
+        $2,
+        $3,
+        NOW(),
+        NOW(),
+        $1
+    )
 RETURNING
-    id, body, user_id, created_at, updated_at
+    id, body, user_id, created_at, updated_at, revision_count, in_reply_to, reply_count, deleted_at, like_count, rechirp_count, search, hidden_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	InReplyTo uuid.NullUUID
+	Body      string
+	UserID    uuid.UUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.InReplyTo, arg.Body, arg.UserID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -34,17 +52,69 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RevisionCount,
+		&i.InReplyTo,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpCount,
+		&i.Search,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
 const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM
+WITH tombstoned AS (
+    UPDATE
+        chirps
+    SET
+        body = '',
+        revision_count = 0,
+        updated_at = NOW(),
+        deleted_at = NOW()
+    WHERE
+        id = $1
+        AND reply_count > 0
+    RETURNING
+        id
+),
+purged AS (
+    DELETE FROM
+        chirp_revisions
+    WHERE
+        chirp_id IN (
+            SELECT
+                id
+            FROM
+                tombstoned
+        )
+),
+deleted AS (
+    DELETE FROM
+        chirps
+    WHERE
+        id = $1
+        AND reply_count = 0
+    RETURNING
+        in_reply_to
+)
+UPDATE
     chirps
+SET
+    reply_count = reply_count - 1
 WHERE
-    id = $1
+    id = (
+        SELECT
+            in_reply_to
+        FROM
+            deleted
+    )
 `
 
+// A chirp with replies is blanked into a placeholder instead, so its thread
+// stays connected. Deleting a chirp outright takes it off its parent's
+// reply count.
 func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, deleteChirp, id)
 	return err
@@ -60,17 +130,95 @@ func (q *Queries) DeleteChirps(ctx context.Context) error {
 	return err
 }
 
-const getAllChirps = `-- name: GetAllChirps :many
+const getChirp = `-- name: GetChirp :one
 SELECT
-    id, body, user_id, created_at, updated_at
+    id, body, user_id, created_at, updated_at, revision_count, in_reply_to, reply_count, deleted_at, like_count, rechirp_count, search, hidden_at
 FROM
     chirps
+WHERE
+    id = $1
+`
+
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RevisionCount,
+		&i.InReplyTo,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpCount,
+		&i.Search,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const hideChirp = `-- name: HideChirp :execrows
+UPDATE
+    chirps
+SET
+    hidden_at = COALESCE(hidden_at, NOW())
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, hideChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT
+        parent.id, parent.body, parent.user_id, parent.created_at, parent.updated_at, parent.revision_count, parent.in_reply_to, parent.reply_count, parent.deleted_at, parent.like_count, parent.rechirp_count, parent.search, parent.hidden_at,
+        1 AS depth
+    FROM
+        chirps child
+        JOIN chirps parent ON parent.id = child.in_reply_to
+    WHERE
+        child.id = $1
+    UNION ALL
+    SELECT
+        chirps.id, chirps.body, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.revision_count, chirps.in_reply_to, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_count, chirps.search, chirps.hidden_at,
+        ancestors.depth + 1
+    FROM
+        chirps
+        JOIN ancestors ON chirps.id = ancestors.in_reply_to
+)
+SELECT
+    id,
+    body,
+    user_id,
+    created_at,
+    updated_at,
+    revision_count,
+    in_reply_to,
+    reply_count,
+    deleted_at,
+    like_count,
+    rechirp_count,
+    search,
+    hidden_at
+FROM
+    ancestors
 ORDER BY
-    created_at
+    depth DESC
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+// Returns the chain of parents of a chirp, starting at the thread root.
+func (q *Queries) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, id)
 	if err != nil {
 		return nil, err
 	}
@@ -84,6 +232,14 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UserID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.RevisionCount,
+			&i.InReplyTo,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.Search,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -98,17 +254,367 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirp = `-- name: GetChirp :one
+const listChirpReplies = `-- name: ListChirpReplies :many
+WITH RECURSIVE replies AS (
+    SELECT
+        chirps.id, chirps.body, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.revision_count, chirps.in_reply_to, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_count, chirps.search, chirps.hidden_at,
+        1 AS depth
+    FROM
+        chirps
+    WHERE
+        in_reply_to = $1
+    UNION ALL
+    SELECT
+        chirps.id, chirps.body, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.revision_count, chirps.in_reply_to, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_count, chirps.search, chirps.hidden_at,
+        replies.depth + 1
+    FROM
+        chirps
+        JOIN replies ON chirps.in_reply_to = replies.id
+)
 SELECT
-    id, body, user_id, created_at, updated_at
+    id, body, user_id, created_at, updated_at, revision_count, in_reply_to, reply_count, deleted_at, like_count, rechirp_count, search, hidden_at, depth
+FROM
+    replies
+WHERE
+    $2::timestamp IS NULL
+    OR (created_at, id) > (
+        $2::timestamp,
+        $3::uuid
+    )
+ORDER BY
+    created_at ASC,
+    id ASC
+LIMIT
+    $4
+`
+
+type ListChirpRepliesParams struct {
+	ChirpID         uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+type ListChirpRepliesRow struct {
+	ID            uuid.UUID
+	Body          string
+	UserID        uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	RevisionCount int32
+	InReplyTo     uuid.NullUUID
+	ReplyCount    int32
+	DeletedAt     sql.NullTime
+	LikeCount     int32
+	RechirpCount  int32
+	Search        interface{}
+	HiddenAt      sql.NullTime
+	Depth         int32
+}
+
+// Returns every reply below a chirp in (created_at, id) order. Parents are
+// always older than their replies, so each page can be stitched onto the
+// tree built from the previous ones.
+func (q *Queries) ListChirpReplies(ctx context.Context, arg ListChirpRepliesParams) ([]ListChirpRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReplies,
+		arg.ChirpID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpRepliesRow
+	for rows.Next() {
+		var i ListChirpRepliesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.RevisionCount,
+			&i.InReplyTo,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.Search,
+			&i.HiddenAt,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpRevisions = `-- name: ListChirpRevisions :many
+SELECT
+    id, chirp_id, body, created_at, replaced_at
+FROM
+    chirp_revisions
+WHERE
+    chirp_id = $1
+ORDER BY
+    replaced_at ASC,
+    id ASC
+`
+
+func (q *Queries) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT
+    id, body, user_id, created_at, updated_at, revision_count, in_reply_to, reply_count, deleted_at, like_count, rechirp_count, search, hidden_at
 FROM
     chirps
 WHERE
-    id = $1
+    (
+        $1::uuid IS NULL
+        OR user_id = $1
+    )
+    AND deleted_at IS NULL
+    AND (
+        hidden_at IS NULL
+        OR user_id = $2
+        OR $3::bool
+    )
+    AND (
+        $4::timestamp IS NULL
+        OR (created_at, id) > (
+            $4::timestamp,
+            $5::uuid
+        )
+    )
+ORDER BY
+    created_at ASC,
+    id ASC
+LIMIT
+    $6
 `
 
-func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirp, id)
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	IncludeHidden   bool
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+// Hidden chirps are only listed for their author and for moderators.
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.ViewerID,
+		arg.IncludeHidden,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.RevisionCount,
+			&i.InReplyTo,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.Search,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT
+    id, body, user_id, created_at, updated_at, revision_count, in_reply_to, reply_count, deleted_at, like_count, rechirp_count, search, hidden_at
+FROM
+    chirps
+WHERE
+    (
+        $1::uuid IS NULL
+        OR user_id = $1
+    )
+    AND deleted_at IS NULL
+    AND (
+        hidden_at IS NULL
+        OR user_id = $2
+        OR $3::bool
+    )
+    AND (
+        $4::timestamp IS NULL
+        OR (created_at, id) < (
+            $4::timestamp,
+            $5::uuid
+        )
+    )
+ORDER BY
+    created_at DESC,
+    id DESC
+LIMIT
+    $6
+`
+
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	IncludeHidden   bool
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+// Hidden chirps are only listed for their author and for moderators.
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.ViewerID,
+		arg.IncludeHidden,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.RevisionCount,
+			&i.InReplyTo,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.Search,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+WITH previous AS (
+    SELECT
+        id,
+        body,
+        updated_at
+    FROM
+        chirps
+    WHERE
+        id = $1
+        AND deleted_at IS NULL
+    FOR UPDATE
+),
+revision AS (
+    INSERT INTO
+        chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT
+        gen_random_uuid(),
+        previous.id,
+        previous.body,
+        previous.updated_at,
+        NOW()
+    FROM
+        previous
+)
+UPDATE
+    chirps
+SET
+    body = $2,
+    updated_at = NOW(),
+    revision_count = chirps.revision_count + 1
+FROM
+    previous
+WHERE
+    chirps.id = previous.id
+RETURNING
+    chirps.id, chirps.body, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.revision_count, chirps.in_reply_to, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_count, chirps.search, chirps.hidden_at
+`
+
+type UpdateChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+// Locking the row first makes concurrent edits queue up, so every replaced
+// body ends up in chirp_revisions.
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.ID, arg.Body)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -116,6 +622,14 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RevisionCount,
+		&i.InReplyTo,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpCount,
+		&i.Search,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -12,26 +12,144 @@ import (
 )
 
 type Chirp struct {
-	ID        uuid.UUID
-	Body      string
+	ID            uuid.UUID
+	Body          string
+	UserID        uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	RevisionCount int32
+	InReplyTo     uuid.NullUUID
+	ReplyCount    int32
+	DeletedAt     sql.NullTime
+	LikeCount     int32
+	RechirpCount  int32
+	Search        interface{}
+	HiddenAt      sql.NullTime
+}
+
+type ChirpFlag struct {
+	ChirpID   uuid.UUID
+	Rule      string
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID   uuid.UUID
 	UserID    uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpReport struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	Comment    string
+	CreatedAt  time.Time
+	ResolvedAt sql.NullTime
+	Resolution sql.NullString
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type ChirpTag struct {
+	ChirpID   uuid.UUID
+	Tag       string
 	CreatedAt time.Time
-	UpdatedAt time.Time
+}
+
+type EmailVerification struct {
+	TokenHash string
 	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type LoginThrottle struct {
+	Key         string
+	Failures    int32
+	LockedUntil sql.NullTime
+	UpdatedAt   time.Time
+}
+
+type ModerationRule struct {
+	ID        uuid.UUID
+	Kind      string
+	Action    string
+	Value     string
+	CreatedAt time.Time
+}
+
+type PasswordReset struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Rechirp struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	Token      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+	UserAgent  string
+	Ip         string
+	DeviceName string
+	LastUsedAt time.Time
 }
 
 type User struct {
-	ID             uuid.UUID
-	Email          string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	HashedPassword string
+	ID              uuid.UUID
+	Email           string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	HashedPassword  string
+	IsChirpyRed     bool
+	Handle          sql.NullString
+	SuspendedAt     sql.NullTime
+	Role            string
+	EmailVerifiedAt sql.NullTime
+	PendingEmail    sql.NullString
+	TotpSecret      sql.NullString
+	TotpEnabledAt   sql.NullTime
+	TotpLastCounter sql.NullInt64
 }
@@ -20,22 +20,39 @@ INSERT INTO
         created_at,
         updated_at,
         user_id,
-        expires_at
+        expires_at,
+        family_id,
+        user_agent,
+        ip,
+        device_name,
+        last_used_at
     )
 VALUES
-    ($1, NOW(), NOW(), $2, $3)
+    ($1, NOW(), NOW(), $2, $3, $4, $5, $6, $7, NOW())
 RETURNING
-    token, created_at, updated_at, user_id, expires_at, revoked_at
+    token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, user_agent, ip, device_name, last_used_at
 `
 
 type CreateTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	ExpiresAt time.Time
+	Token      string
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	FamilyID   uuid.UUID
+	UserAgent  string
+	Ip         string
+	DeviceName string
 }
 
 func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.Ip,
+		arg.DeviceName,
+	)
 	var i RefreshToken
 	err := row.Scan(
 		&i.Token,
@@ -44,6 +61,12 @@ func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Refre
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.UserAgent,
+		&i.Ip,
+		&i.DeviceName,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
@@ -51,8 +74,11 @@ func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Refre
 const getToken = `-- name: GetToken :one
 SELECT
     token,
+    user_id,
+    family_id,
     expires_at,
-    revoked_at
+    revoked_at,
+    device_name
 FROM
     refresh_tokens
 WHERE
@@ -60,15 +86,25 @@ WHERE
 `
 
 type GetTokenRow struct {
-	Token     string
-	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	Token      string
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	DeviceName string
 }
 
 func (q *Queries) GetToken(ctx context.Context, token string) (GetTokenRow, error) {
 	row := q.db.QueryRowContext(ctx, getToken, token)
 	var i GetTokenRow
-	err := row.Scan(&i.Token, &i.ExpiresAt, &i.RevokedAt)
+	err := row.Scan(
+		&i.Token,
+		&i.UserID,
+		&i.FamilyID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.DeviceName,
+	)
 	return i, err
 }
 
@@ -89,6 +125,122 @@ func (q *Queries) GetUserForToken(ctx context.Context, token string) (uuid.NullU
 	return id, err
 }
 
+const listSessions = `-- name: ListSessions :many
+SELECT
+    t.family_id,
+    t.device_name,
+    t.user_agent,
+    t.ip,
+    t.last_used_at,
+    (
+        SELECT
+            MIN(f.created_at)
+        FROM
+            refresh_tokens f
+        WHERE
+            f.family_id = t.family_id
+    )::timestamp AS signed_in_at
+FROM
+    refresh_tokens t
+WHERE
+    t.user_id = $1
+    AND t.revoked_at IS NULL
+    AND t.expires_at > NOW()
+ORDER BY
+    t.last_used_at DESC,
+    t.family_id
+`
+
+type ListSessionsRow struct {
+	FamilyID   uuid.UUID
+	DeviceName string
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+	SignedInAt time.Time
+}
+
+// Each live session has exactly one unrevoked token, the latest rotation.
+func (q *Queries) ListSessions(ctx context.Context, userID uuid.UUID) ([]ListSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSessionsRow
+	for rows.Next() {
+		var i ListSessionsRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.DeviceName,
+			&i.UserAgent,
+			&i.Ip,
+			&i.LastUsedAt,
+			&i.SignedInAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :execrows
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND family_id <> $2
+    AND revoked_at IS NULL
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeOtherSessions, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND family_id = $2
+    AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const revokeToken = `-- name: RevokeToken :exec
 UPDATE
     refresh_tokens
@@ -103,3 +255,60 @@ func (q *Queries) RevokeToken(ctx context.Context, token string) error {
 	_, err := q.db.ExecContext(ctx, revokeToken, token)
 	return err
 }
+
+const revokeTokenFamily = `-- name: RevokeTokenFamily :exec
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = $1
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeTokenFamily, familyID)
+	return err
+}
+
+const revokeUserTokens = `-- name: RevokeUserTokens :exec
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserTokens, userID)
+	return err
+}
+
+const rotateToken = `-- name: RotateToken :execrows
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW(),
+    replaced_by = $2
+WHERE
+    token = $1
+    AND revoked_at IS NULL
+`
+
+type RotateTokenParams struct {
+	Token      string
+	ReplacedBy sql.NullString
+}
+
+func (q *Queries) RotateToken(ctx context.Context, arg RotateTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateToken, arg.Token, arg.ReplacedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
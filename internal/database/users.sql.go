@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,37 +20,42 @@ INSERT INTO
         email,
         created_at,
         updated_at,
-        hashed_password
+        hashed_password,
+        handle
     )
 VALUES
-    (gen_random_uuid(), $1, NOW(), NOW(), $2)
+    (gen_random_uuid(), $1, NOW(), NOW(), $2, $3)
 RETURNING
     id,
     email,
     created_at,
-    updated_at
+    updated_at,
+    is_chirpy_red
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         sql.NullString
 }
 
 type CreateUserRow struct {
-	ID        uuid.UUID
-	Email     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          uuid.UUID
+	Email       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	IsChirpyRed bool
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.Email,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsChirpyRed,
 	)
 	return i, err
 }
@@ -64,9 +70,35 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const enableUserTOTP = `-- name: EnableUserTOTP :execrows
+UPDATE
+    users
+SET
+    totp_enabled_at = NOW(),
+    totp_last_counter = $2,
+    updated_at = NOW()
+WHERE
+    id = $1
+    AND totp_secret IS NOT NULL
+    AND totp_enabled_at IS NULL
+`
+
+type EnableUserTOTPParams struct {
+	ID              uuid.UUID
+	TotpLastCounter sql.NullInt64
+}
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableUserTOTP, arg.ID, arg.TotpLastCounter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUserWithEmail = `-- name: GetUserWithEmail :one
 SELECT
-    id, email, created_at, updated_at, hashed_password
+    id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, suspended_at, role, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_counter
 FROM
     users
 WHERE
@@ -82,13 +114,22 @@ func (q *Queries) GetUserWithEmail(ctx context.Context, email string) (User, err
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastCounter,
 	)
 	return i, err
 }
 
 const getUserWithId = `-- name: GetUserWithId :one
 SELECT
-    id, email, created_at, updated_at, hashed_password
+    id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, suspended_at, role, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_counter
 FROM
     users
 WHERE
@@ -104,47 +145,250 @@ func (q *Queries) GetUserWithId(ctx context.Context, id uuid.UUID) (User, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastCounter,
 	)
 	return i, err
 }
 
-const updateUserEmailAndPassword = `-- name: UpdateUserEmailAndPassword :one
+const setUserChirpyRed = `-- name: SetUserChirpyRed :execrows
+UPDATE
+    users
+SET
+    is_chirpy_red = $2,
+    updated_at = NOW()
+WHERE
+    id = $1
+`
+
+type SetUserChirpyRedParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+func (q *Queries) SetUserChirpyRed(ctx context.Context, arg SetUserChirpyRedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserChirpyRed, arg.ID, arg.IsChirpyRed)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE
+    users
+SET
+    role = $2,
+    updated_at = NOW()
+WHERE
+    email = $1
+`
+
+type SetUserRoleParams struct {
+	Email string
+	Role  string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.Email, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :execrows
+UPDATE
+    users
+SET
+    totp_secret = $2,
+    updated_at = NOW()
+WHERE
+    id = $1
+    AND totp_enabled_at IS NULL
+`
+
+type SetUserTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserTOTPSecret, arg.ID, arg.TotpSecret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const suspendUser = `-- name: SuspendUser :execrows
 UPDATE
     users
 SET
-    email = $2,
-    hashed_password = $3,
+    suspended_at = COALESCE(suspended_at, NOW()),
     updated_at = NOW()
 WHERE
     id = $1
+`
+
+func (q *Queries) SuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, suspendUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUserAccount = `-- name: UpdateUserAccount :one
+UPDATE
+    users
+SET
+    hashed_password = $1,
+    handle = COALESCE($2, handle),
+    pending_email = $3,
+    updated_at = NOW()
+WHERE
+    id = $4
 RETURNING
-    id,
-    email,
-    created_at,
-    updated_at
+    id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, suspended_at, role, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_counter
 `
 
-type UpdateUserEmailAndPasswordParams struct {
+type UpdateUserAccountParams struct {
+	HashedPassword string
+	Handle         sql.NullString
+	PendingEmail   sql.NullString
+	ID             uuid.UUID
+}
+
+// The email itself only changes once the pending address is verified.
+func (q *Queries) UpdateUserAccount(ctx context.Context, arg UpdateUserAccountParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserAccount,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.PendingEmail,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastCounter,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE
+    users
+SET
+    hashed_password = $2,
+    updated_at = NOW()
+WHERE
+    id = $1
+`
+
+type UpdateUserPasswordParams struct {
 	ID             uuid.UUID
-	Email          string
 	HashedPassword string
 }
 
-type UpdateUserEmailAndPasswordRow struct {
-	ID        uuid.UUID
-	Email     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const useTOTPCounter = `-- name: UseTOTPCounter :execrows
+UPDATE
+    users
+SET
+    totp_last_counter = $2
+WHERE
+    id = $1
+    AND (
+        totp_last_counter IS NULL
+        OR totp_last_counter < $2
+    )
+`
+
+type UseTOTPCounterParams struct {
+	ID              uuid.UUID
+	TotpLastCounter sql.NullInt64
+}
+
+// Only moves forward, so two logins racing with the same code can't both
+// succeed.
+func (q *Queries) UseTOTPCounter(ctx context.Context, arg UseTOTPCounterParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPCounter, arg.ID, arg.TotpLastCounter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-func (q *Queries) UpdateUserEmailAndPassword(ctx context.Context, arg UpdateUserEmailAndPasswordParams) (UpdateUserEmailAndPasswordRow, error) {
-	row := q.db.QueryRowContext(ctx, updateUserEmailAndPassword, arg.ID, arg.Email, arg.HashedPassword)
-	var i UpdateUserEmailAndPasswordRow
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE
+    users
+SET
+    email = $1,
+    email_verified_at = NOW(),
+    pending_email = CASE
+        WHEN pending_email = $1 THEN NULL
+        ELSE pending_email
+    END,
+    updated_at = NOW()
+WHERE
+    id = $2
+    AND (
+        email = $1
+        OR pending_email = $1
+    )
+RETURNING
+    id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, suspended_at, role, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_counter
+`
+
+type VerifyUserEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+// Confirms either the current address or the pending one. A token for an
+// address the user has since replaced matches no row.
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.Email, arg.ID)
+	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Email,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastCounter,
 	)
 	return i, err
 }
@@ -0,0 +1,117 @@
+// Package entities finds #hashtags and @mentions in chirp bodies.
+//
+// Offsets count Unicode code points, not bytes, so clients can slice the body
+// the same way regardless of how it is encoded on the wire.
+package entities
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	Hashtag = "hashtag"
+	Mention = "mention"
+)
+
+const (
+	maxTagLength    = 64
+	maxHandleLength = 15
+)
+
+// Entity is a hashtag or mention in a body. Text is the normalised tag or
+// handle without its sigil; Start and End cover the sigil too, End exclusive.
+type Entity struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Parse returns the entities in body in the order they appear. A sigil only
+// starts an entity at the beginning of a word, so e-mail addresses and
+// anchors like "a#b" are left alone.
+func Parse(body string) []Entity {
+	runes := []rune(body)
+	entities := []Entity{}
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' && runes[i] != '@' {
+			continue
+		}
+		if i > 0 && (isTagRune(runes[i-1]) || runes[i-1] == '#' || runes[i-1] == '@') {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isTagRune(runes[end]) {
+			end++
+		}
+		word := string(runes[i+1 : end])
+
+		switch runes[i] {
+		case '#':
+			if tag, ok := NormalizeTag(word); ok {
+				entities = append(entities, Entity{Type: Hashtag, Text: tag, Start: i, End: end})
+			}
+		case '@':
+			if handle, ok := NormalizeHandle(word); ok {
+				entities = append(entities, Entity{Type: Mention, Text: handle, Start: i, End: end})
+			}
+		}
+		i = end - 1
+	}
+
+	return entities
+}
+
+// Texts returns the distinct texts of the entities of the given type.
+func Texts(entities []Entity, typ string) []string {
+	texts := []string{}
+	for _, e := range entities {
+		if e.Type == typ && !slices.Contains(texts, e.Text) {
+			texts = append(texts, e.Text)
+		}
+	}
+	return texts
+}
+
+// NormalizeTag lowercases a tag, with or without its leading '#'. A tag is
+// letters, digits and underscores with at least one letter, so "#1" is not
+// a tag.
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	n := 0
+	hasLetter := false
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", false
+		}
+		hasLetter = hasLetter || unicode.IsLetter(r)
+		n++
+	}
+	if !hasLetter || n > maxTagLength {
+		return "", false
+	}
+	return tag, true
+}
+
+// NormalizeHandle lowercases a handle, with or without its leading '@'.
+// Handles are 1 to 15 ASCII letters, digits or underscores.
+func NormalizeHandle(handle string) (string, bool) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	if handle == "" || len(handle) > maxHandleLength {
+		return "", false
+	}
+	for _, r := range handle {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return "", false
+		}
+	}
+	return handle, true
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
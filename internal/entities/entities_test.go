@@ -0,0 +1,68 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Entity
+	}{
+		{"none", "nothing to see here", []Entity{}},
+		{"hashtag", "cooking #Science", []Entity{{Hashtag, "science", 8, 16}}},
+		{"mention", "@Walt say my name", []Entity{{Mention, "walt", 0, 5}}},
+		{"both", "@jesse #cook now", []Entity{{Mention, "jesse", 0, 6}, {Hashtag, "cook", 7, 12}}},
+		{"code points", "héllo #café @w", []Entity{{Hashtag, "café", 6, 11}, {Mention, "w", 12, 14}}},
+		{"punctuation", "(#tag), @me!", []Entity{{Hashtag, "tag", 1, 5}, {Mention, "me", 8, 11}}},
+		{"email", "mail walt@breakingbad.com", []Entity{}},
+		{"mid word", "a#b c@d", []Entity{}},
+		{"numeric tag", "#1 #2cool", []Entity{{Hashtag, "2cool", 3, 9}}},
+		{"handle too long", "@abcdefghijklmnop", []Entity{}},
+		{"doubled sigil", "##tag @@me", []Entity{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Parse(tc.body)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Parse(%q) = %+v, want %+v", tc.body, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTexts(t *testing.T) {
+	entities := Parse("#go #Go @a #rust @a")
+
+	if got := Texts(entities, Hashtag); !reflect.DeepEqual(got, []string{"go", "rust"}) {
+		t.Fatalf("unexpected tags %v", got)
+	}
+	if got := Texts(entities, Mention); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("unexpected mentions %v", got)
+	}
+}
+
+func TestNormalizeHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   string
+		ok     bool
+	}{
+		{"Walt", "walt", true},
+		{"@jesse_p", "jesse_p", true},
+		{"", "", false},
+		{"with space", "", false},
+		{"héllo", "", false},
+		{"abcdefghijklmnop", "", false},
+	}
+
+	for _, tc := range tests {
+		got, ok := NormalizeHandle(tc.handle)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("NormalizeHandle(%q) = %q, %v, want %q, %v", tc.handle, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package events fans out chirp change notifications to live subscribers and
+// keeps a bounded replay buffer so reconnecting clients can resume.
+package events
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ChirpCreated = "chirp.created"
+	ChirpUpdated = "chirp.updated"
+	ChirpDeleted = "chirp.deleted"
+	// ChirpHidden is sent when a moderator hides a chirp. Subscribers should
+	// drop it just like a deleted one.
+	ChirpHidden = "chirp.hidden"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is dropped. Dropped clients reconnect and catch up from the replay buffer.
+const subscriberBuffer = 64
+
+type Event struct {
+	ID       uint64
+	Type     string
+	AuthorID uuid.UUID
+	Data     []byte
+}
+
+type Broker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	replay      []Event
+	replaySize  int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	broker *Broker
+}
+
+func NewBroker(replaySize int) *Broker {
+	return &Broker{
+		replaySize:  replaySize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the next event ID, stores the event for replay and delivers
+// it to every subscriber without blocking.
+func (b *Broker) Publish(eventType string, authorID uuid.UUID, data []byte) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	ev := Event{
+		ID:       b.lastID,
+		Type:     eventType,
+		AuthorID: authorID,
+		Data:     data,
+	}
+
+	if b.closed {
+		return ev
+	}
+
+	if b.replaySize > 0 {
+		if len(b.replay) == b.replaySize {
+			copy(b.replay, b.replay[1:])
+			b.replay = b.replay[:len(b.replay)-1]
+		}
+		b.replay = append(b.replay, ev)
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.c <- ev:
+		default:
+			b.remove(sub)
+		}
+	}
+
+	return ev
+}
+
+// Subscribe registers a new subscriber. Buffered events newer than
+// lastEventID are returned for replay; pass 0 to skip replay.
+func (b *Broker) Subscribe(lastEventID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, broker: b}
+	if b.closed {
+		close(c)
+		return sub, nil
+	}
+	b.subscribers[sub] = struct{}{}
+
+	var missed []Event
+	if lastEventID > 0 && lastEventID <= b.lastID {
+		for _, ev := range b.replay {
+			if ev.ID > lastEventID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+
+	return sub, missed
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
+
+// Close disconnects every subscriber and rejects new ones.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.remove(sub)
+	}
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.c)
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPublishDeliversToSubscribers(t *testing.T) {
+	b := NewBroker(10)
+	sub, missed := b.Subscribe(0)
+	defer sub.Close()
+
+	if len(missed) != 0 {
+		t.Fatalf("expected no replay for a fresh subscriber, got %d events", len(missed))
+	}
+
+	author := uuid.New()
+	b.Publish(ChirpCreated, author, []byte(`{}`))
+
+	ev := <-sub.C
+	if ev.ID != 1 || ev.Type != ChirpCreated || ev.AuthorID != author {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
+
+func TestSubscribeReplaysMissedEvents(t *testing.T) {
+	b := NewBroker(3)
+	for range 5 {
+		b.Publish(ChirpCreated, uuid.New(), nil)
+	}
+
+	sub, missed := b.Subscribe(3)
+	defer sub.Close()
+
+	if len(missed) != 2 || missed[0].ID != 4 || missed[1].ID != 5 {
+		t.Fatalf("expected events 4 and 5, got %+v", missed)
+	}
+
+	// Events that fell out of the buffer can't be replayed.
+	sub2, missed := b.Subscribe(1)
+	defer sub2.Close()
+
+	if len(missed) != 3 || missed[0].ID != 3 {
+		t.Fatalf("expected the 3 buffered events starting at 3, got %+v", missed)
+	}
+}
+
+func TestSubscribeIgnoresUnknownLastEventID(t *testing.T) {
+	b := NewBroker(3)
+	b.Publish(ChirpCreated, uuid.New(), nil)
+
+	sub, missed := b.Subscribe(42)
+	defer sub.Close()
+
+	if len(missed) != 0 {
+		t.Fatalf("expected no replay for an ID from the future, got %+v", missed)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(0)
+	sub, _ := b.Subscribe(0)
+	defer sub.Close()
+
+	for range subscriberBuffer + 1 {
+		b.Publish(ChirpCreated, uuid.New(), nil)
+	}
+
+	count := 0
+	for range sub.C {
+		count++
+	}
+	if count != subscriberBuffer {
+		t.Fatalf("expected %d buffered events before the drop, got %d", subscriberBuffer, count)
+	}
+}
+
+func TestCloseDisconnectsSubscribers(t *testing.T) {
+	b := NewBroker(1)
+	sub, _ := b.Subscribe(0)
+
+	b.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatalf("expected subscription channel to be closed")
+	}
+	sub.Close()
+
+	late, _ := b.Subscribe(0)
+	if _, ok := <-late.C; ok {
+		t.Fatalf("expected subscriptions after Close to be closed")
+	}
+}
@@ -0,0 +1,131 @@
+// Package mail sends the emails chirpy needs, such as password resets.
+//
+// SMTP delivers real mail. Outbox keeps messages in memory, and optionally
+// writes them to a directory, for development and tests.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// validate rejects header values that would let a recipient address or
+// subject inject extra headers.
+func (m Message) validate() error {
+	if strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(m.Subject, "\r\n") {
+		return errors.New("mail headers must not contain line breaks")
+	}
+	return nil
+}
+
+// bytes renders the message as an RFC 5322 plain text email.
+func (m Message) bytes(from string, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTP sends mail through a relay. Username may be empty for relays that
+// don't authenticate; otherwise PLAIN auth is used, which net/smtp only
+// allows over TLS or to localhost.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	// net/smtp has no context support, so a cancelled request only stops
+	// waiting for the send; the connection finishes on its own.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- smtp.SendMail(addr, auth, s.From, []string{msg.To}, msg.bytes(s.From, time.Now()))
+	}()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			return fmt.Errorf("sending mail to %s: %w", msg.To, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Outbox records messages instead of delivering them. When Dir is set each
+// message is also written there as a .eml file.
+type Outbox struct {
+	Dir  string
+	From string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, msg)
+	if o.Dir == "" {
+		return nil
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%03d.eml", now.UTC().Format("20060102T150405.000000"), len(o.messages))
+	if err := os.WriteFile(filepath.Join(o.Dir, name), msg.bytes(o.From, now), 0o600); err != nil {
+		return fmt.Errorf("writing outbox message: %w", err)
+	}
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message(nil), o.messages...)
+}
@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox := &Outbox{Dir: dir, From: "chirpy@example.com"}
+
+	msg := Message{To: "walt@breakingbad.com", Subject: "Hello", Body: "line one\nline two"}
+	if err := outbox.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+
+	if got := outbox.Messages(); len(got) != 1 || got[0] != msg {
+		t.Fatalf("unexpected messages %+v", got)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v (%v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	for _, want := range []string{"From: chirpy@example.com\r\n", "To: walt@breakingbad.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in:\n%s", want, data)
+		}
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	outbox := &Outbox{}
+
+	for _, msg := range []Message{
+		{To: "walt@breakingbad.com\r\nBcc: jesse@breakingbad.com", Subject: "Hello"},
+		{To: "walt@breakingbad.com", Subject: "Hello\nBcc: jesse@breakingbad.com"},
+	} {
+		if err := outbox.Send(context.Background(), msg); err == nil {
+			t.Errorf("expected an error for %+v", msg)
+		}
+	}
+	if n := len(outbox.Messages()); n != 0 {
+		t.Fatalf("rejected messages were recorded: %d", n)
+	}
+}
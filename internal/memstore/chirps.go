@@ -0,0 +1,271 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.Chirp{}, foreignKeyViolation("chirps_user_id_fkey")
+	}
+
+	if arg.InReplyTo.Valid {
+		parent, ok := s.chirps[arg.InReplyTo.UUID]
+		if !ok {
+			return database.Chirp{}, foreignKeyViolation("chirps_in_reply_to_fkey")
+		}
+		parent.ReplyCount++
+		s.chirps[parent.ID] = parent
+	}
+
+	t := now()
+	c := database.Chirp{
+		ID:        uuid.New(),
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		CreatedAt: t,
+		UpdatedAt: t,
+		InReplyTo: arg.InReplyTo,
+	}
+	s.chirps[c.ID] = c
+	return c, nil
+}
+
+func (s *Store) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.chirps[id]
+	if !ok {
+		return nil
+	}
+
+	delete(s.revisions, id)
+
+	// Chirps with replies stay behind as placeholders, like in the SQL query.
+	if c.ReplyCount > 0 {
+		t := now()
+		c.Body = ""
+		c.RevisionCount = 0
+		c.UpdatedAt = t
+		c.DeletedAt = sql.NullTime{Time: t, Valid: true}
+		s.chirps[id] = c
+		return nil
+	}
+
+	delete(s.chirps, id)
+	onChirp := func(key reactionKey, _ time.Time) bool { return key.chirp == id }
+	maps.DeleteFunc(s.likes, onChirp)
+	maps.DeleteFunc(s.rechirps, onChirp)
+	maps.DeleteFunc(s.mentions, onChirp)
+	maps.DeleteFunc(s.tags, func(key tagKey, _ time.Time) bool { return key.chirp == id })
+	maps.DeleteFunc(s.flags, func(key flagKey, _ time.Time) bool { return key.chirp == id })
+	maps.DeleteFunc(s.reports, func(_ uuid.UUID, r database.ChirpReport) bool { return r.ChirpID == id })
+	if parent, ok := s.chirps[c.InReplyTo.UUID]; ok && c.InReplyTo.Valid {
+		parent.ReplyCount--
+		s.chirps[parent.ID] = parent
+	}
+	return nil
+}
+
+func (s *Store) DeleteChirps(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.chirps)
+	clear(s.revisions)
+	clear(s.likes)
+	clear(s.rechirps)
+	clear(s.tags)
+	clear(s.mentions)
+	clear(s.flags)
+	clear(s.reports)
+	return nil
+}
+
+func (s *Store) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+// listChirps returns the chirps matching keep in (created_at, id) order,
+// starting after the cursor and capped at pageSize.
+func (s *Store) listChirps(keep func(database.Chirp) bool, cursorCreatedAt sql.NullTime, cursorID uuid.NullUUID, pageSize int32, desc bool) []database.Chirp {
+	var items []database.Chirp
+	for _, c := range s.chirps {
+		if !keep(c) {
+			continue
+		}
+		if cursorCreatedAt.Valid {
+			if desc && !before(c.CreatedAt, c.ID, cursorCreatedAt.Time, cursorID.UUID) {
+				continue
+			}
+			if !desc && !before(cursorCreatedAt.Time, cursorID.UUID, c.CreatedAt, c.ID) {
+				continue
+			}
+		}
+		items = append(items, c)
+	}
+
+	slices.SortFunc(items, func(a, b database.Chirp) int {
+		if before(a.CreatedAt, a.ID, b.CreatedAt, b.ID) == desc {
+			return 1
+		}
+		return -1
+	})
+
+	if len(items) > int(pageSize) {
+		items = items[:pageSize]
+	}
+	return items
+}
+
+// listable mirrors the WHERE clause of ListChirpsAsc and ListChirpsDesc.
+func listable(authorID, viewerID uuid.NullUUID, includeHidden bool) func(database.Chirp) bool {
+	return func(c database.Chirp) bool {
+		if c.DeletedAt.Valid || (authorID.Valid && c.UserID != authorID.UUID) {
+			return false
+		}
+		return !c.HiddenAt.Valid || (viewerID.Valid && c.UserID == viewerID.UUID) || includeHidden
+	}
+}
+
+func (s *Store) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listChirps(listable(arg.AuthorID, arg.ViewerID, arg.IncludeHidden), arg.CursorCreatedAt, arg.CursorID, arg.PageSize, false), nil
+}
+
+func (s *Store) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listChirps(listable(arg.AuthorID, arg.ViewerID, arg.IncludeHidden), arg.CursorCreatedAt, arg.CursorID, arg.PageSize, true), nil
+}
+
+func (s *Store) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []database.Chirp
+	c, ok := s.chirps[id]
+	for ok && c.InReplyTo.Valid {
+		c, ok = s.chirps[c.InReplyTo.UUID]
+		if ok {
+			items = append(items, c)
+		}
+	}
+	slices.Reverse(items)
+	return items, nil
+}
+
+// replyDepth returns how many replies deep c sits below the chirp rootID, or
+// 0 when c is not below it.
+func (s *Store) replyDepth(c database.Chirp, rootID uuid.UUID) int32 {
+	var depth int32
+	for c.InReplyTo.Valid {
+		depth++
+		if c.InReplyTo.UUID == rootID {
+			return depth
+		}
+		parent, ok := s.chirps[c.InReplyTo.UUID]
+		if !ok {
+			return 0
+		}
+		c = parent
+	}
+	return 0
+}
+
+func (s *Store) ListChirpReplies(ctx context.Context, arg database.ListChirpRepliesParams) ([]database.ListChirpRepliesRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	replies := s.listChirps(func(c database.Chirp) bool {
+		return s.replyDepth(c, arg.ChirpID) > 0
+	}, arg.CursorCreatedAt, arg.CursorID, arg.PageSize, false)
+
+	var items []database.ListChirpRepliesRow
+	for _, c := range replies {
+		items = append(items, database.ListChirpRepliesRow{
+			ID:            c.ID,
+			Body:          c.Body,
+			UserID:        c.UserID,
+			CreatedAt:     c.CreatedAt,
+			UpdatedAt:     c.UpdatedAt,
+			RevisionCount: c.RevisionCount,
+			InReplyTo:     c.InReplyTo,
+			ReplyCount:    c.ReplyCount,
+			DeletedAt:     c.DeletedAt,
+			LikeCount:     c.LikeCount,
+			RechirpCount:  c.RechirpCount,
+			HiddenAt:      c.HiddenAt,
+			Depth:         s.replyDepth(c, arg.ChirpID),
+		})
+	}
+	return items, nil
+}
+
+func (s *Store) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.revisions[chirpID]), nil
+}
+
+func (s *Store) UpdateChirp(ctx context.Context, arg database.UpdateChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.chirps[arg.ID]
+	if !ok || c.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+
+	t := now()
+	s.revisions[c.ID] = append(s.revisions[c.ID], database.ChirpRevision{
+		ID:         uuid.New(),
+		ChirpID:    c.ID,
+		Body:       c.Body,
+		CreatedAt:  c.UpdatedAt,
+		ReplacedAt: t,
+	})
+
+	c.Body = arg.Body
+	c.UpdatedAt = t
+	c.RevisionCount++
+	s.chirps[c.ID] = c
+	return c, nil
+}
+
+func (s *Store) HideChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.chirps[id]
+	if !ok || c.DeletedAt.Valid {
+		return 0, nil
+	}
+	if !c.HiddenAt.Valid {
+		c.HiddenAt = sql.NullTime{Time: now(), Valid: true}
+		s.chirps[id] = c
+	}
+	return 1, nil
+}
@@ -0,0 +1,44 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+)
+
+func (s *Store) CreateEmailVerification(ctx context.Context, arg database.CreateEmailVerificationParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.verifications[arg.TokenHash]; ok {
+		return uniqueViolation("email_verifications_pkey")
+	}
+	if _, ok := s.users[arg.UserID]; !ok {
+		return foreignKeyViolation("email_verifications_user_id_fkey")
+	}
+
+	n := now()
+	s.verifications[arg.TokenHash] = database.EmailVerification{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		Email:     arg.Email,
+		CreatedAt: n,
+		ExpiresAt: n.Add(seconds(arg.TtlSeconds)),
+	}
+	return nil
+}
+
+func (s *Store) ConsumeEmailVerification(ctx context.Context, tokenHash string) (database.ConsumeEmailVerificationRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.verifications[tokenHash]
+	n := now()
+	if !ok || v.UsedAt.Valid || !v.ExpiresAt.After(n) {
+		return database.ConsumeEmailVerificationRow{}, sql.ErrNoRows
+	}
+	v.UsedAt = sql.NullTime{Time: n, Valid: true}
+	s.verifications[tokenHash] = v
+	return database.ConsumeEmailVerificationRow{UserID: v.UserID, Email: v.Email}, nil
+}
@@ -0,0 +1,136 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CountFollowers(ctx context.Context, followeeID uuid.UUID) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for k := range s.follows {
+		if k.followee == followeeID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) CountFollowing(ctx context.Context, followerID uuid.UUID) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for k := range s.follows {
+		if k.follower == followerID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if arg.FollowerID == arg.FolloweeID {
+		return checkViolation("follows_check")
+	}
+	if _, ok := s.users[arg.FollowerID]; !ok {
+		return foreignKeyViolation("follows_follower_id_fkey")
+	}
+	if _, ok := s.users[arg.FolloweeID]; !ok {
+		return foreignKeyViolation("follows_followee_id_fkey")
+	}
+
+	key := followKey{follower: arg.FollowerID, followee: arg.FolloweeID}
+	if _, ok := s.follows[key]; ok {
+		return nil
+	}
+	s.follows[key] = database.Follow{
+		FollowerID: arg.FollowerID,
+		FolloweeID: arg.FolloweeID,
+		CreatedAt:  now(),
+	}
+	return nil
+}
+
+func (s *Store) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.follows, followKey{follower: arg.FollowerID, followee: arg.FolloweeID})
+	return nil
+}
+
+// listFollows pages through the users on the other side of the follows
+// matched by keep, newest first.
+func (s *Store) listFollows(keep func(database.Follow) (uuid.UUID, bool), cursorCreatedAt sql.NullTime, cursorID uuid.NullUUID, pageSize int32) []database.ListFollowersRow {
+	var items []database.ListFollowersRow
+	for _, f := range s.follows {
+		other, ok := keep(f)
+		if !ok {
+			continue
+		}
+		if cursorCreatedAt.Valid && !before(f.CreatedAt, other, cursorCreatedAt.Time, cursorID.UUID) {
+			continue
+		}
+		items = append(items, database.ListFollowersRow{
+			ID:         other,
+			Handle:     s.users[other].Handle,
+			FollowedAt: f.CreatedAt,
+		})
+	}
+
+	slices.SortFunc(items, func(a, b database.ListFollowersRow) int {
+		if before(a.FollowedAt, a.ID, b.FollowedAt, b.ID) {
+			return 1
+		}
+		return -1
+	})
+
+	if len(items) > int(pageSize) {
+		items = items[:pageSize]
+	}
+	return items
+}
+
+func (s *Store) ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.ListFollowersRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listFollows(func(f database.Follow) (uuid.UUID, bool) {
+		return f.FollowerID, f.FolloweeID == arg.UserID
+	}, arg.CursorCreatedAt, arg.CursorID, arg.PageSize), nil
+}
+
+func (s *Store) ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.ListFollowingRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows := s.listFollows(func(f database.Follow) (uuid.UUID, bool) {
+		return f.FolloweeID, f.FollowerID == arg.UserID
+	}, arg.CursorCreatedAt, arg.CursorID, arg.PageSize)
+
+	items := make([]database.ListFollowingRow, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, database.ListFollowingRow(row))
+	}
+	return items, nil
+}
+
+func (s *Store) GetTimeline(ctx context.Context, arg database.GetTimelineParams) ([]database.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listChirps(func(c database.Chirp) bool {
+		_, ok := s.follows[followKey{follower: arg.FollowerID, followee: c.UserID}]
+		return ok && !c.DeletedAt.Valid && !c.HiddenAt.Valid
+	}, arg.CursorCreatedAt, arg.CursorID, arg.PageSize, true), nil
+}
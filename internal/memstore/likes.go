@@ -0,0 +1,166 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// reactionKey pairs a user with a chirp. Likes, rechirps and mentions only
+// record that pair and when it was made.
+type reactionKey struct {
+	user  uuid.UUID
+	chirp uuid.UUID
+}
+
+type reactionRow struct {
+	userID    uuid.UUID
+	handle    sql.NullString
+	createdAt time.Time
+}
+
+// addReaction inserts a reaction and bumps the chirp's counter, doing nothing
+// when it already exists.
+func (s *Store) addReaction(reactions map[reactionKey]time.Time, counter func(c *database.Chirp) *int32, constraint string, userID, chirpID uuid.UUID) (int64, error) {
+	if _, ok := s.users[userID]; !ok {
+		return 0, foreignKeyViolation(constraint + "_user_id_fkey")
+	}
+	c, ok := s.chirps[chirpID]
+	if !ok {
+		return 0, foreignKeyViolation(constraint + "_chirp_id_fkey")
+	}
+
+	key := reactionKey{user: userID, chirp: chirpID}
+	if _, ok := reactions[key]; ok {
+		return 0, nil
+	}
+	reactions[key] = now()
+
+	*counter(&c)++
+	s.chirps[chirpID] = c
+	return 1, nil
+}
+
+func (s *Store) removeReaction(reactions map[reactionKey]time.Time, counter func(c *database.Chirp) *int32, userID, chirpID uuid.UUID) int64 {
+	key := reactionKey{user: userID, chirp: chirpID}
+	if _, ok := reactions[key]; !ok {
+		return 0
+	}
+	delete(reactions, key)
+
+	c := s.chirps[chirpID]
+	*counter(&c)--
+	s.chirps[chirpID] = c
+	return 1
+}
+
+func (s *Store) listReactions(reactions map[reactionKey]time.Time, chirpID uuid.UUID, cursorCreatedAt sql.NullTime, cursorID uuid.NullUUID, pageSize int32) []reactionRow {
+	var items []reactionRow
+	for key, createdAt := range reactions {
+		if key.chirp != chirpID {
+			continue
+		}
+		if cursorCreatedAt.Valid && !before(createdAt, key.user, cursorCreatedAt.Time, cursorID.UUID) {
+			continue
+		}
+		items = append(items, reactionRow{userID: key.user, handle: s.users[key.user].Handle, createdAt: createdAt})
+	}
+
+	slices.SortFunc(items, func(a, b reactionRow) int {
+		if before(a.createdAt, a.userID, b.createdAt, b.userID) {
+			return 1
+		}
+		return -1
+	})
+
+	if len(items) > int(pageSize) {
+		items = items[:pageSize]
+	}
+	return items
+}
+
+func reactedChirpIDs(reactions map[reactionKey]time.Time, userID uuid.UUID, chirpIDs []uuid.UUID) []uuid.UUID {
+	var items []uuid.UUID
+	for _, id := range chirpIDs {
+		if _, ok := reactions[reactionKey{user: userID, chirp: id}]; ok {
+			items = append(items, id)
+		}
+	}
+	return items
+}
+
+func likeCount(c *database.Chirp) *int32 {
+	return &c.LikeCount
+}
+
+func rechirpCount(c *database.Chirp) *int32 {
+	return &c.RechirpCount
+}
+
+func (s *Store) LikeChirp(ctx context.Context, arg database.LikeChirpParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addReaction(s.likes, likeCount, "likes", arg.UserID, arg.ChirpID)
+}
+
+func (s *Store) UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeReaction(s.likes, likeCount, arg.UserID, arg.ChirpID), nil
+}
+
+func (s *Store) ListChirpLikes(ctx context.Context, arg database.ListChirpLikesParams) ([]database.ListChirpLikesRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []database.ListChirpLikesRow
+	for _, row := range s.listReactions(s.likes, arg.ChirpID, arg.CursorCreatedAt, arg.CursorID, arg.PageSize) {
+		items = append(items, database.ListChirpLikesRow{ID: row.userID, Handle: row.handle, LikedAt: row.createdAt})
+	}
+	return items, nil
+}
+
+func (s *Store) ListLikedChirpIDs(ctx context.Context, arg database.ListLikedChirpIDsParams) ([]uuid.UUID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return reactedChirpIDs(s.likes, arg.UserID, arg.ChirpIds), nil
+}
+
+func (s *Store) RechirpChirp(ctx context.Context, arg database.RechirpChirpParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addReaction(s.rechirps, rechirpCount, "rechirps", arg.UserID, arg.ChirpID)
+}
+
+func (s *Store) UnrechirpChirp(ctx context.Context, arg database.UnrechirpChirpParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeReaction(s.rechirps, rechirpCount, arg.UserID, arg.ChirpID), nil
+}
+
+func (s *Store) ListChirpRechirps(ctx context.Context, arg database.ListChirpRechirpsParams) ([]database.ListChirpRechirpsRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []database.ListChirpRechirpsRow
+	for _, row := range s.listReactions(s.rechirps, arg.ChirpID, arg.CursorCreatedAt, arg.CursorID, arg.PageSize) {
+		items = append(items, database.ListChirpRechirpsRow{ID: row.userID, Handle: row.handle, RechirpedAt: row.createdAt})
+	}
+	return items, nil
+}
+
+func (s *Store) ListRechirpedChirpIDs(ctx context.Context, arg database.ListRechirpedChirpIDsParams) ([]uuid.UUID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return reactedChirpIDs(s.rechirps, arg.UserID, arg.ChirpIds), nil
+}
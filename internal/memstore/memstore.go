@@ -0,0 +1,119 @@
+// Package memstore is an in-memory implementation of database.Querier for
+// tests and local development without PostgreSQL.
+//
+// It mirrors the behaviour of the SQL queries closely enough for the handlers
+// to work unchanged: missing rows return sql.ErrNoRows and constraint
+// violations return *pq.Error with the code PostgreSQL would use.
+package memstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type followKey struct {
+	follower uuid.UUID
+	followee uuid.UUID
+}
+
+type Store struct {
+	mu      sync.RWMutex
+	users   map[uuid.UUID]database.User
+	chirps  map[uuid.UUID]database.Chirp
+	tokens  map[string]database.RefreshToken
+	follows map[followKey]database.Follow
+	// revisions holds each chirp's replaced bodies, oldest first.
+	revisions map[uuid.UUID][]database.ChirpRevision
+	likes     map[reactionKey]time.Time
+	rechirps  map[reactionKey]time.Time
+	tags      map[tagKey]time.Time
+	mentions  map[reactionKey]time.Time
+	rules     map[uuid.UUID]database.ModerationRule
+	flags     map[flagKey]time.Time
+	reports   map[uuid.UUID]database.ChirpReport
+	resets    map[string]database.PasswordReset
+	// verifications are keyed by token hash like resets.
+	verifications map[string]database.EmailVerification
+	recoveryCodes map[uuid.UUID]database.RecoveryCode
+	// throttles aren't tied to users and survive DeleteUsers, as they do
+	// in the database.
+	throttles map[string]database.LoginThrottle
+}
+
+var _ database.Querier = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		users:   make(map[uuid.UUID]database.User),
+		chirps:  make(map[uuid.UUID]database.Chirp),
+		tokens:  make(map[string]database.RefreshToken),
+		follows: make(map[followKey]database.Follow),
+
+		revisions: make(map[uuid.UUID][]database.ChirpRevision),
+		likes:     make(map[reactionKey]time.Time),
+		rechirps:  make(map[reactionKey]time.Time),
+		tags:      make(map[tagKey]time.Time),
+		mentions:  make(map[reactionKey]time.Time),
+		rules:     make(map[uuid.UUID]database.ModerationRule),
+		flags:     make(map[flagKey]time.Time),
+		reports:   make(map[uuid.UUID]database.ChirpReport),
+		resets:    make(map[string]database.PasswordReset),
+
+		verifications: make(map[string]database.EmailVerification),
+		recoveryCodes: make(map[uuid.UUID]database.RecoveryCode),
+		throttles:     make(map[string]database.LoginThrottle),
+	}
+}
+
+// now matches the microsecond precision of a PostgreSQL TIMESTAMP so cursors
+// round-trip the same way they do against the real database.
+func now() time.Time {
+	return time.Now().UTC().Round(time.Microsecond)
+}
+
+// seconds is the duration of a make_interval(secs => s) argument.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func uniqueViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23505",
+		Message:    "duplicate key value violates unique constraint \"" + constraint + "\"",
+		Constraint: constraint,
+	}
+}
+
+func foreignKeyViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23503",
+		Message:    "insert or update violates foreign key constraint \"" + constraint + "\"",
+		Constraint: constraint,
+	}
+}
+
+func checkViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23514",
+		Message:    "new row violates check constraint \"" + constraint + "\"",
+		Constraint: constraint,
+	}
+}
+
+// before reports whether (t1, id1) sorts before (t2, id2), the row order
+// used by every paginated query.
+func before(t1 time.Time, id1 uuid.UUID, t2 time.Time, id2 uuid.UUID) bool {
+	if !t1.Equal(t2) {
+		return t1.Before(t2)
+	}
+	for i := range id1 {
+		if id1[i] != id2[i] {
+			return id1[i] < id2[i]
+		}
+	}
+	return false
+}
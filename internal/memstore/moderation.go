@@ -0,0 +1,105 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type flagKey struct {
+	chirp uuid.UUID
+	rule  string
+}
+
+var ruleKinds = []string{"word", "regex", "domain", "max_mentions"}
+
+var ruleActions = []string{"mask", "flag", "reject"}
+
+func (s *Store) CreateModerationRule(ctx context.Context, arg database.CreateModerationRuleParams) (database.ModerationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Contains(ruleKinds, arg.Kind) {
+		return database.ModerationRule{}, checkViolation("moderation_rules_kind_check")
+	}
+	if !slices.Contains(ruleActions, arg.Action) {
+		return database.ModerationRule{}, checkViolation("moderation_rules_action_check")
+	}
+	for _, r := range s.rules {
+		if r.Kind == arg.Kind && r.Value == arg.Value {
+			return database.ModerationRule{}, uniqueViolation("moderation_rules_kind_value_key")
+		}
+	}
+
+	r := database.ModerationRule{
+		ID:        uuid.New(),
+		Kind:      arg.Kind,
+		Action:    arg.Action,
+		Value:     arg.Value,
+		CreatedAt: now(),
+	}
+	s.rules[r.ID] = r
+	return r, nil
+}
+
+func (s *Store) ListModerationRules(ctx context.Context) ([]database.ModerationRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []database.ModerationRule
+	for _, r := range s.rules {
+		items = append(items, r)
+	}
+	slices.SortFunc(items, func(a, b database.ModerationRule) int {
+		if before(a.CreatedAt, a.ID, b.CreatedAt, b.ID) {
+			return -1
+		}
+		return 1
+	})
+	return items, nil
+}
+
+func (s *Store) DeleteModerationRule(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return 0, nil
+	}
+	delete(s.rules, id)
+	return 1, nil
+}
+
+func (s *Store) FlagChirp(ctx context.Context, arg database.FlagChirpParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chirps[arg.ChirpID]; !ok {
+		return foreignKeyViolation("chirp_flags_chirp_id_fkey")
+	}
+
+	t := now()
+	for _, rule := range arg.Rules {
+		key := flagKey{chirp: arg.ChirpID, rule: rule}
+		if _, ok := s.flags[key]; !ok {
+			s.flags[key] = t
+		}
+	}
+	return nil
+}
+
+func (s *Store) ClearChirpFlags(ctx context.Context, chirpID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for key := range s.flags {
+		if key.chirp == chirpID {
+			delete(s.flags, key)
+			n++
+		}
+	}
+	return n, nil
+}
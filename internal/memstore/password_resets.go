@@ -0,0 +1,56 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreatePasswordReset(ctx context.Context, arg database.CreatePasswordResetParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.resets[arg.TokenHash]; ok {
+		return uniqueViolation("password_resets_pkey")
+	}
+	if _, ok := s.users[arg.UserID]; !ok {
+		return foreignKeyViolation("password_resets_user_id_fkey")
+	}
+
+	n := now()
+	s.resets[arg.TokenHash] = database.PasswordReset{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		CreatedAt: n,
+		ExpiresAt: n.Add(seconds(arg.TtlSeconds)),
+	}
+	return nil
+}
+
+func (s *Store) ConsumePasswordReset(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset, ok := s.resets[tokenHash]
+	n := now()
+	if !ok || reset.UsedAt.Valid || !reset.ExpiresAt.After(n) {
+		return uuid.Nil, sql.ErrNoRows
+	}
+	reset.UsedAt = sql.NullTime{Time: n, Valid: true}
+	s.resets[tokenHash] = reset
+	return reset.UserID, nil
+}
+
+func (s *Store) DeletePasswordResets(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, reset := range s.resets {
+		if reset.UserID == userID {
+			delete(s.resets, k)
+		}
+	}
+	return nil
+}
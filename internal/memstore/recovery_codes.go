@@ -0,0 +1,65 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateRecoveryCode(ctx context.Context, arg database.CreateRecoveryCodeParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.UserID]; !ok {
+		return foreignKeyViolation("recovery_codes_user_id_fkey")
+	}
+
+	code := database.RecoveryCode{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		CodeHash:  arg.CodeHash,
+		CreatedAt: now(),
+	}
+	s.recoveryCodes[code.ID] = code
+	return nil
+}
+
+func (s *Store) ListRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]database.ListRecoveryCodesRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rows []database.ListRecoveryCodesRow
+	for _, code := range s.recoveryCodes {
+		if code.UserID == userID && !code.UsedAt.Valid {
+			rows = append(rows, database.ListRecoveryCodesRow{ID: code.ID, CodeHash: code.CodeHash})
+		}
+	}
+	return rows, nil
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.recoveryCodes[id]
+	if !ok || code.UsedAt.Valid {
+		return 0, nil
+	}
+	code.UsedAt = sql.NullTime{Time: now(), Valid: true}
+	s.recoveryCodes[id] = code
+	return 1, nil
+}
+
+func (s *Store) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, code := range s.recoveryCodes {
+		if code.UserID == userID {
+			delete(s.recoveryCodes, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "misinformation", "other"}
+
+var reportResolutions = []string{"dismiss", "hide", "delete", "suspend"}
+
+func (s *Store) CreateReport(ctx context.Context, arg database.CreateReportParams) (database.ChirpReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Contains(reportReasons, arg.Reason) {
+		return database.ChirpReport{}, checkViolation("chirp_reports_reason_check")
+	}
+	if _, ok := s.chirps[arg.ChirpID]; !ok {
+		return database.ChirpReport{}, foreignKeyViolation("chirp_reports_chirp_id_fkey")
+	}
+	if _, ok := s.users[arg.ReporterID]; !ok {
+		return database.ChirpReport{}, foreignKeyViolation("chirp_reports_reporter_id_fkey")
+	}
+	for _, r := range s.reports {
+		if r.ChirpID == arg.ChirpID && r.ReporterID == arg.ReporterID && !r.ResolvedAt.Valid {
+			return database.ChirpReport{}, uniqueViolation("chirp_reports_open_key")
+		}
+	}
+
+	r := database.ChirpReport{
+		ID:         uuid.New(),
+		ChirpID:    arg.ChirpID,
+		ReporterID: arg.ReporterID,
+		Reason:     arg.Reason,
+		Comment:    arg.Comment,
+		CreatedAt:  now(),
+	}
+	s.reports[r.ID] = r
+	return r, nil
+}
+
+func (s *Store) ListModerationQueue(ctx context.Context, arg database.ListModerationQueueParams) ([]database.ListModerationQueueRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows := make(map[uuid.UUID]*database.ListModerationQueueRow)
+	queue := func(chirpID uuid.UUID, at time.Time) *database.ListModerationQueueRow {
+		c := s.chirps[chirpID]
+		if c.DeletedAt.Valid {
+			return nil
+		}
+		row, ok := rows[c.ID]
+		if !ok {
+			row = &database.ListModerationQueueRow{
+				ID:            c.ID,
+				Body:          c.Body,
+				UserID:        c.UserID,
+				CreatedAt:     c.CreatedAt,
+				UpdatedAt:     c.UpdatedAt,
+				RevisionCount: c.RevisionCount,
+				InReplyTo:     c.InReplyTo,
+				ReplyCount:    c.ReplyCount,
+				DeletedAt:     c.DeletedAt,
+				LikeCount:     c.LikeCount,
+				RechirpCount:  c.RechirpCount,
+				HiddenAt:      c.HiddenAt,
+				QueuedAt:      at,
+				Reasons:       []string{},
+				Rules:         []string{},
+			}
+			rows[c.ID] = row
+		}
+		if at.Before(row.QueuedAt) {
+			row.QueuedAt = at
+		}
+		return row
+	}
+
+	for _, r := range s.reports {
+		if r.ResolvedAt.Valid {
+			continue
+		}
+		if row := queue(r.ChirpID, r.CreatedAt); row != nil {
+			row.ReportCount++
+			if !slices.Contains(row.Reasons, r.Reason) {
+				row.Reasons = append(row.Reasons, r.Reason)
+			}
+		}
+	}
+	for key, createdAt := range s.flags {
+		if row := queue(key.chirp, createdAt); row != nil {
+			row.Rules = append(row.Rules, key.rule)
+		}
+	}
+
+	var items []database.ListModerationQueueRow
+	for _, row := range rows {
+		if arg.CursorCreatedAt.Valid && !before(arg.CursorCreatedAt.Time, arg.CursorID.UUID, row.QueuedAt, row.ID) {
+			continue
+		}
+		slices.Sort(row.Reasons)
+		slices.Sort(row.Rules)
+		items = append(items, *row)
+	}
+	slices.SortFunc(items, func(a, b database.ListModerationQueueRow) int {
+		if before(a.QueuedAt, a.ID, b.QueuedAt, b.ID) {
+			return -1
+		}
+		return 1
+	})
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items, nil
+}
+
+func (s *Store) IsChirpQueued(ctx context.Context, chirpID uuid.UUID) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.reports {
+		if r.ChirpID == chirpID && !r.ResolvedAt.Valid {
+			return true, nil
+		}
+	}
+	for key := range s.flags {
+		if key.chirp == chirpID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) ResolveChirpReports(ctx context.Context, arg database.ResolveChirpReportsParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Contains(reportResolutions, arg.Resolution) {
+		return 0, checkViolation("chirp_reports_resolution_check")
+	}
+
+	var n int64
+	t := now()
+	for id, r := range s.reports {
+		if r.ChirpID != arg.ChirpID || r.ResolvedAt.Valid {
+			continue
+		}
+		r.ResolvedAt = sql.NullTime{Time: t, Valid: true}
+		r.Resolution = sql.NullString{String: arg.Resolution, Valid: true}
+		s.reports[id] = r
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,118 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/search"
+	"github.com/google/uuid"
+)
+
+// rank stands in for ts_rank: the share of the body's words that the query
+// matched.
+func rank(q search.Query, body string) float32 {
+	words := search.Words(body)
+	if len(words) == 0 {
+		return 0
+	}
+
+	wanted := slices.Clone(q.Terms)
+	for _, p := range q.Phrases {
+		wanted = append(wanted, search.Words(p)...)
+	}
+
+	matched := 0
+	for _, w := range words {
+		if slices.Contains(wanted, w) {
+			matched++
+		}
+	}
+	return float32(matched) / float32(len(words))
+}
+
+// SearchChirps matches whole words without stemming, so it finds fewer
+// chirps than the PostgreSQL query for the same input.
+func (s *Store) SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var q search.Query
+	if arg.Query != "" {
+		parsed, err := search.Parse(arg.Query)
+		if err != nil {
+			return nil, err
+		}
+		q = parsed
+	}
+
+	var authorID uuid.NullUUID
+	if arg.FromHandle.Valid {
+		for _, u := range s.users {
+			if u.Handle == arg.FromHandle {
+				authorID = uuid.NullUUID{UUID: u.ID, Valid: true}
+			}
+		}
+		if !authorID.Valid {
+			return nil, nil
+		}
+	}
+
+	var items []database.SearchChirpsRow
+	for _, c := range s.chirps {
+		if c.DeletedAt.Valid || c.HiddenAt.Valid || !q.Match(c.Body) {
+			continue
+		}
+		if authorID.Valid && c.UserID != authorID.UUID {
+			continue
+		}
+		if arg.Since.Valid && c.CreatedAt.Before(arg.Since.Time) {
+			continue
+		}
+		if arg.Until.Valid && !c.CreatedAt.Before(arg.Until.Time) {
+			continue
+		}
+
+		row := database.SearchChirpsRow{
+			ID:            c.ID,
+			Body:          c.Body,
+			UserID:        c.UserID,
+			CreatedAt:     c.CreatedAt,
+			UpdatedAt:     c.UpdatedAt,
+			RevisionCount: c.RevisionCount,
+			InReplyTo:     c.InReplyTo,
+			ReplyCount:    c.ReplyCount,
+			DeletedAt:     c.DeletedAt,
+			LikeCount:     c.LikeCount,
+			RechirpCount:  c.RechirpCount,
+			Rank:          rank(q, c.Body),
+			Snippet:       q.Highlight(c.Body),
+		}
+		if arg.CursorCreatedAt.Valid && !searchBefore(row, float32(arg.CursorRank.Float64), arg.CursorCreatedAt.Time, arg.CursorID.UUID) {
+			continue
+		}
+		items = append(items, row)
+	}
+
+	slices.SortFunc(items, func(a, b database.SearchChirpsRow) int {
+		if searchBefore(a, b.Rank, b.CreatedAt, b.ID) {
+			return 1
+		}
+		return -1
+	})
+
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items, nil
+}
+
+// searchBefore reports whether row sorts before the given position in
+// (rank, created_at, id) order.
+func searchBefore(row database.SearchChirpsRow, rank float32, createdAt time.Time, id uuid.UUID) bool {
+	if row.Rank != rank {
+		return row.Rank < rank
+	}
+	return before(row.CreatedAt, row.ID, createdAt, id)
+}
@@ -0,0 +1,136 @@
+package memstore
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type tagKey struct {
+	chirp uuid.UUID
+	tag   string
+}
+
+func (s *Store) SetChirpTags(ctx context.Context, arg database.SetChirpTagsParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chirps[arg.ChirpID]; !ok {
+		return foreignKeyViolation("chirp_tags_chirp_id_fkey")
+	}
+
+	for key := range s.tags {
+		if key.chirp == arg.ChirpID && !slices.Contains(arg.Tags, key.tag) {
+			delete(s.tags, key)
+		}
+	}
+
+	t := now()
+	for _, tag := range arg.Tags {
+		key := tagKey{chirp: arg.ChirpID, tag: tag}
+		if _, ok := s.tags[key]; !ok {
+			s.tags[key] = t
+		}
+	}
+	return nil
+}
+
+func (s *Store) ListTagChirps(ctx context.Context, arg database.ListTagChirpsParams) ([]database.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keep := func(c database.Chirp) bool {
+		_, ok := s.tags[tagKey{chirp: c.ID, tag: arg.Tag}]
+		return ok && !c.DeletedAt.Valid && !c.HiddenAt.Valid
+	}
+	return s.listChirps(keep, arg.CursorCreatedAt, arg.CursorID, arg.PageSize, true), nil
+}
+
+func (s *Store) ListTrendingTags(ctx context.Context, arg database.ListTrendingTagsParams) ([]database.ListTrendingTagsRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := now()
+	since := n.Add(-time.Duration(arg.WindowHours) * time.Hour)
+	rows := make(map[string]*database.ListTrendingTagsRow)
+	for key, createdAt := range s.tags {
+		if c := s.chirps[key.chirp]; !createdAt.After(since) || c.DeletedAt.Valid || c.HiddenAt.Valid {
+			continue
+		}
+
+		row, ok := rows[key.tag]
+		if !ok {
+			row = &database.ListTrendingTagsRow{Tag: key.tag}
+			rows[key.tag] = row
+		}
+		row.Uses++
+		row.Score += math.Pow(0.5, n.Sub(createdAt).Seconds()/arg.HalfLifeSeconds)
+	}
+
+	var items []database.ListTrendingTagsRow
+	for _, row := range rows {
+		items = append(items, *row)
+	}
+
+	slices.SortFunc(items, func(a, b database.ListTrendingTagsRow) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+
+	if len(items) > int(arg.RowLimit) {
+		items = items[:arg.RowLimit]
+	}
+	return items, nil
+}
+
+func (s *Store) SetChirpMentions(ctx context.Context, arg database.SetChirpMentionsParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chirps[arg.ChirpID]; !ok {
+		return foreignKeyViolation("chirp_mentions_chirp_id_fkey")
+	}
+
+	mentioned := make(map[uuid.UUID]bool)
+	for _, u := range s.users {
+		if u.Handle.Valid && slices.Contains(arg.Handles, u.Handle.String) {
+			mentioned[u.ID] = true
+		}
+	}
+
+	for key := range s.mentions {
+		if key.chirp == arg.ChirpID && !mentioned[key.user] {
+			delete(s.mentions, key)
+		}
+	}
+
+	t := now()
+	for id := range mentioned {
+		key := reactionKey{user: id, chirp: arg.ChirpID}
+		if _, ok := s.mentions[key]; !ok {
+			s.mentions[key] = t
+		}
+	}
+	return nil
+}
+
+func (s *Store) ListMentions(ctx context.Context, arg database.ListMentionsParams) ([]database.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keep := func(c database.Chirp) bool {
+		_, ok := s.mentions[reactionKey{user: arg.UserID, chirp: c.ID}]
+		return ok && !c.DeletedAt.Valid && !c.HiddenAt.Valid
+	}
+	return s.listChirps(keep, arg.CursorCreatedAt, arg.CursorID, arg.PageSize, true), nil
+}
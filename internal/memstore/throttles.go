@@ -0,0 +1,59 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+)
+
+func (s *Store) GetLoginLockout(ctx context.Context, key string) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.throttles[key]
+	if !ok || !t.LockedUntil.Valid {
+		return 0, sql.ErrNoRows
+	}
+	left := t.LockedUntil.Time.Sub(now())
+	if left <= 0 {
+		return 0, sql.ErrNoRows
+	}
+	return left.Seconds(), nil
+}
+
+func (s *Store) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.throttles[arg.Key]
+	if !ok || t.UpdatedAt.Before(now().Add(-seconds(arg.WindowSeconds))) {
+		t.Key = arg.Key
+		t.Failures = 0
+	}
+	t.Failures++
+	t.UpdatedAt = now()
+	s.throttles[arg.Key] = t
+	return t.Failures, nil
+}
+
+func (s *Store) LockLogin(ctx context.Context, arg database.LockLoginParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.throttles[arg.Key]
+	if !ok {
+		return nil
+	}
+	t.LockedUntil = sql.NullTime{Time: now().Add(seconds(arg.LockoutSeconds)), Valid: true}
+	s.throttles[arg.Key] = t
+	return nil
+}
+
+func (s *Store) ClearLoginThrottle(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.throttles, key)
+	return nil
+}
@@ -0,0 +1,197 @@
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateToken(ctx context.Context, arg database.CreateTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[arg.Token]; ok {
+		return database.RefreshToken{}, uniqueViolation("refresh_tokens_pkey")
+	}
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, foreignKeyViolation("refresh_tokens_user_id_fkey")
+	}
+
+	t := now()
+	token := database.RefreshToken{
+		Token:      arg.Token,
+		CreatedAt:  t,
+		UpdatedAt:  t,
+		UserID:     arg.UserID,
+		ExpiresAt:  arg.ExpiresAt,
+		FamilyID:   arg.FamilyID,
+		UserAgent:  arg.UserAgent,
+		Ip:         arg.Ip,
+		DeviceName: arg.DeviceName,
+		LastUsedAt: t,
+	}
+	s.tokens[token.Token] = token
+	return token, nil
+}
+
+func (s *Store) GetToken(ctx context.Context, token string) (database.GetTokenRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tokens[token]
+	if !ok {
+		return database.GetTokenRow{}, sql.ErrNoRows
+	}
+	return database.GetTokenRow{
+		Token:      t.Token,
+		UserID:     t.UserID,
+		FamilyID:   t.FamilyID,
+		ExpiresAt:  t.ExpiresAt,
+		RevokedAt:  t.RevokedAt,
+		DeviceName: t.DeviceName,
+	}, nil
+}
+
+func (s *Store) GetUserForToken(ctx context.Context, token string) (uuid.NullUUID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tokens[token]
+	if !ok {
+		return uuid.NullUUID{}, sql.ErrNoRows
+	}
+	if _, ok := s.users[t.UserID]; !ok {
+		return uuid.NullUUID{}, nil
+	}
+	return uuid.NullUUID{UUID: t.UserID, Valid: true}, nil
+}
+
+func (s *Store) RevokeToken(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[token]
+	if !ok {
+		return nil
+	}
+	n := now()
+	t.RevokedAt = sql.NullTime{Time: n, Valid: true}
+	t.UpdatedAt = n
+	s.tokens[token] = t
+	return nil
+}
+
+func (s *Store) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := now()
+	for k, t := range s.tokens {
+		if t.FamilyID != familyID || t.RevokedAt.Valid {
+			continue
+		}
+		t.RevokedAt = sql.NullTime{Time: n, Valid: true}
+		t.UpdatedAt = n
+		s.tokens[k] = t
+	}
+	return nil
+}
+
+func (s *Store) RotateToken(ctx context.Context, arg database.RotateTokenParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[arg.Token]
+	if !ok || t.RevokedAt.Valid {
+		return 0, nil
+	}
+	n := now()
+	t.RevokedAt = sql.NullTime{Time: n, Valid: true}
+	t.UpdatedAt = n
+	t.ReplacedBy = arg.ReplacedBy
+	s.tokens[arg.Token] = t
+	return 1, nil
+}
+
+func (s *Store) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := now()
+	for k, t := range s.tokens {
+		if t.UserID != userID || t.RevokedAt.Valid {
+			continue
+		}
+		t.RevokedAt = sql.NullTime{Time: n, Valid: true}
+		t.UpdatedAt = n
+		s.tokens[k] = t
+	}
+	return nil
+}
+
+func (s *Store) ListSessions(ctx context.Context, userID uuid.UUID) ([]database.ListSessionsRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	signedIn := make(map[uuid.UUID]time.Time)
+	for _, t := range s.tokens {
+		if first, ok := signedIn[t.FamilyID]; !ok || t.CreatedAt.Before(first) {
+			signedIn[t.FamilyID] = t.CreatedAt
+		}
+	}
+
+	n := now()
+	var rows []database.ListSessionsRow
+	for _, t := range s.tokens {
+		if t.UserID != userID || t.RevokedAt.Valid || !t.ExpiresAt.After(n) {
+			continue
+		}
+		rows = append(rows, database.ListSessionsRow{
+			FamilyID:   t.FamilyID,
+			DeviceName: t.DeviceName,
+			UserAgent:  t.UserAgent,
+			Ip:         t.Ip,
+			LastUsedAt: t.LastUsedAt,
+			SignedInAt: signedIn[t.FamilyID],
+		})
+	}
+
+	slices.SortFunc(rows, func(a, b database.ListSessionsRow) int {
+		if c := b.LastUsedAt.Compare(a.LastUsedAt); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.FamilyID[:], b.FamilyID[:])
+	})
+	return rows, nil
+}
+
+func (s *Store) RevokeSession(ctx context.Context, arg database.RevokeSessionParams) (int64, error) {
+	return s.revokeSessions(arg.UserID, func(familyID uuid.UUID) bool { return familyID == arg.FamilyID }), nil
+}
+
+func (s *Store) RevokeOtherSessions(ctx context.Context, arg database.RevokeOtherSessionsParams) (int64, error) {
+	return s.revokeSessions(arg.UserID, func(familyID uuid.UUID) bool { return familyID != arg.FamilyID }), nil
+}
+
+func (s *Store) revokeSessions(userID uuid.UUID, match func(familyID uuid.UUID) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	n := now()
+	for k, t := range s.tokens {
+		if t.UserID != userID || t.RevokedAt.Valid || !match(t.FamilyID) {
+			continue
+		}
+		t.RevokedAt = sql.NullTime{Time: n, Valid: true}
+		t.UpdatedAt = n
+		s.tokens[k] = t
+		count++
+	}
+	return count
+}
@@ -0,0 +1,262 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var userRoles = []string{"user", "moderator", "admin"}
+
+func (s *Store) emailTaken(email string, except uuid.UUID) bool {
+	for _, u := range s.users {
+		if u.Email == email && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) handleTaken(handle sql.NullString, except uuid.UUID) bool {
+	if !handle.Valid {
+		return false
+	}
+	for _, u := range s.users {
+		if u.Handle == handle && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(arg.Email, uuid.Nil) {
+		return database.CreateUserRow{}, uniqueViolation("users_email_key")
+	}
+	if s.handleTaken(arg.Handle, uuid.Nil) {
+		return database.CreateUserRow{}, uniqueViolation("users_handle_key")
+	}
+
+	t := now()
+	u := database.User{
+		ID:             uuid.New(),
+		Email:          arg.Email,
+		CreatedAt:      t,
+		UpdatedAt:      t,
+		HashedPassword: arg.HashedPassword,
+		Handle:         arg.Handle,
+		Role:           "user",
+	}
+	s.users[u.ID] = u
+
+	return database.CreateUserRow{
+		ID:          u.ID,
+		Email:       u.Email,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		IsChirpyRed: u.IsChirpyRed,
+	}, nil
+}
+
+func (s *Store) DeleteUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.users)
+	clear(s.chirps)
+	clear(s.tokens)
+	clear(s.follows)
+	clear(s.revisions)
+	clear(s.likes)
+	clear(s.rechirps)
+	clear(s.tags)
+	clear(s.mentions)
+	clear(s.flags)
+	clear(s.reports)
+	clear(s.resets)
+	clear(s.verifications)
+	clear(s.recoveryCodes)
+	return nil
+}
+
+func (s *Store) GetUserWithEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUserWithId(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (s *Store) SetUserChirpyRed(ctx context.Context, arg database.SetUserChirpyRedParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[arg.ID]
+	if !ok {
+		return 0, nil
+	}
+	u.IsChirpyRed = arg.IsChirpyRed
+	u.UpdatedAt = now()
+	s.users[u.ID] = u
+	return 1, nil
+}
+
+func (s *Store) UpdateUserAccount(ctx context.Context, arg database.UpdateUserAccountParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if s.handleTaken(arg.Handle, u.ID) {
+		return database.User{}, uniqueViolation("users_handle_key")
+	}
+
+	u.HashedPassword = arg.HashedPassword
+	if arg.Handle.Valid {
+		u.Handle = arg.Handle
+	}
+	u.PendingEmail = arg.PendingEmail
+	u.UpdatedAt = now()
+	s.users[u.ID] = u
+
+	return u, nil
+}
+
+func (s *Store) VerifyUserEmail(ctx context.Context, arg database.VerifyUserEmailParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[arg.ID]
+	if !ok || (u.Email != arg.Email && u.PendingEmail.String != arg.Email) {
+		return database.User{}, sql.ErrNoRows
+	}
+	if s.emailTaken(arg.Email, u.ID) {
+		return database.User{}, uniqueViolation("users_email_key")
+	}
+
+	t := now()
+	u.Email = arg.Email
+	u.EmailVerifiedAt = sql.NullTime{Time: t, Valid: true}
+	if u.PendingEmail.String == arg.Email {
+		u.PendingEmail = sql.NullString{}
+	}
+	u.UpdatedAt = t
+	s.users[u.ID] = u
+
+	return u, nil
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[arg.ID]
+	if !ok {
+		return nil
+	}
+	u.HashedPassword = arg.HashedPassword
+	u.UpdatedAt = now()
+	s.users[u.ID] = u
+	return nil
+}
+
+func (s *Store) SuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return 0, nil
+	}
+	t := now()
+	if !u.SuspendedAt.Valid {
+		u.SuspendedAt = sql.NullTime{Time: t, Valid: true}
+	}
+	u.UpdatedAt = t
+	s.users[id] = u
+	return 1, nil
+}
+
+func (s *Store) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Contains(userRoles, arg.Role) {
+		return 0, checkViolation("users_role_check")
+	}
+	for id, u := range s.users {
+		if u.Email == arg.Email {
+			u.Role = arg.Role
+			u.UpdatedAt = now()
+			s.users[id] = u
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *Store) SetUserTOTPSecret(ctx context.Context, arg database.SetUserTOTPSecretParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[arg.ID]
+	if !ok || u.TotpEnabledAt.Valid {
+		return 0, nil
+	}
+	u.TotpSecret = arg.TotpSecret
+	u.UpdatedAt = now()
+	s.users[u.ID] = u
+	return 1, nil
+}
+
+func (s *Store) EnableUserTOTP(ctx context.Context, arg database.EnableUserTOTPParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[arg.ID]
+	if !ok || !u.TotpSecret.Valid || u.TotpEnabledAt.Valid {
+		return 0, nil
+	}
+	t := now()
+	u.TotpEnabledAt = sql.NullTime{Time: t, Valid: true}
+	u.TotpLastCounter = arg.TotpLastCounter
+	u.UpdatedAt = t
+	s.users[u.ID] = u
+	return 1, nil
+}
+
+func (s *Store) UseTOTPCounter(ctx context.Context, arg database.UseTOTPCounterParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[arg.ID]
+	if !ok || (u.TotpLastCounter.Valid && u.TotpLastCounter.Int64 >= arg.TotpLastCounter.Int64) {
+		return 0, nil
+	}
+	u.TotpLastCounter = arg.TotpLastCounter
+	s.users[u.ID] = u
+	return 1, nil
+}
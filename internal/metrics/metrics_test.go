@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func render(r *Registry) string {
+	var b strings.Builder
+	r.WriteText(&b)
+	return b.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("chirpy_requests_total", "Requests served.", "route", "status")
+
+	c.Inc("GET /api/chirps", "2xx")
+	c.Inc("GET /api/chirps", "2xx")
+	c.Inc(`POST "quoted"`, "4xx")
+
+	want := `# HELP chirpy_requests_total Requests served.
+# TYPE chirpy_requests_total counter
+chirpy_requests_total{route="GET /api/chirps",status="2xx"} 2
+chirpy_requests_total{route="POST \"quoted\"",status="4xx"} 1
+`
+	if got := render(r); got != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("chirpy_duration_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+	h.Observe(0.05, "GET /api/healthz")
+	h.Observe(0.5, "GET /api/healthz")
+	h.Observe(2, "GET /api/healthz")
+
+	want := `# HELP chirpy_duration_seconds Latency.
+# TYPE chirpy_duration_seconds histogram
+chirpy_duration_seconds_bucket{route="GET /api/healthz",le="0.1"} 1
+chirpy_duration_seconds_bucket{route="GET /api/healthz",le="1"} 2
+chirpy_duration_seconds_bucket{route="GET /api/healthz",le="+Inf"} 3
+chirpy_duration_seconds_sum{route="GET /api/healthz"} 2.55
+chirpy_duration_seconds_count{route="GET /api/healthz"} 3
+`
+	if got := render(r); got != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFuncMetrics(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("chirpy_db_open_connections", "Open connections.", func() float64 { return 3 })
+	r.NewCounterFunc("chirpy_fileserver_hits_total", "Hits.", func() float64 { return 7 })
+
+	out := render(r)
+	for _, line := range []string{
+		"# TYPE chirpy_db_open_connections gauge\nchirpy_db_open_connections 3\n",
+		"# TYPE chirpy_fileserver_hits_total counter\nchirpy_fileserver_hits_total 7\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatalf("expected %q in:\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package migrate applies the embedded goose migrations in sql/schema.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/arnicfil/go_learn_http_chirpy/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// lockID is the Postgres advisory lock key held while migrating, so replicas
+// booting together apply migrations one at a time.
+const lockID int64 = 0x636869727079 // "chirpy"
+
+var ErrUnknownCommand = errors.New("unknown migrate command, expected up, down, status or redo")
+
+func newProvider(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker(lock.WithLockID(lockID))
+	if err != nil {
+		return nil, fmt.Errorf("creating migration lock: %w", err)
+	}
+
+	return goose.NewProvider(goose.DialectPostgres, db, schema.FS, goose.WithSessionLocker(locker))
+}
+
+// Up applies every pending migration.
+func Up(ctx context.Context, db *sql.DB, w io.Writer) error {
+	return Run(ctx, db, "up", w)
+}
+
+// Run executes a migrate subcommand and reports what it did to w.
+func Run(ctx context.Context, db *sql.DB, command string, w io.Writer) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		results, err := provider.Up(ctx)
+		for _, result := range results {
+			fmt.Fprintln(w, result)
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+	case "down":
+		result, err := provider.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, result)
+	case "redo":
+		result, err := provider.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, result)
+
+		result, err = provider.UpByOne(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, result)
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "Pending"
+			if status.State == goose.StateApplied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%-20s %s\n", appliedAt, status.Source.Path)
+		}
+	default:
+		return ErrUnknownCommand
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/arnicfil/go_learn_http_chirpy/sql/schema"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	names, err := fs.Glob(schema.FS, "*.sql")
+	if err != nil {
+		t.Fatalf("listing embedded migrations: %v", err)
+	}
+	if len(names) == 0 {
+		t.Fatalf("expected embedded migrations, found none")
+	}
+
+	for i, name := range names {
+		prefix := fmt.Sprintf("%03d_", i+1)
+		if !strings.HasPrefix(name, prefix) {
+			t.Fatalf("expected migration %d to start with %q, got %q", i+1, prefix, name)
+		}
+
+		body, err := fs.ReadFile(schema.FS, name)
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if !strings.Contains(string(body), "-- +goose Up") || !strings.Contains(string(body), "-- +goose Down") {
+			t.Fatalf("%s is missing goose Up/Down annotations", name)
+		}
+	}
+}
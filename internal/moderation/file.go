@@ -0,0 +1,55 @@
+package moderation
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the YAML layout of a rules file:
+//
+//	rules:
+//	  - kind: word
+//	    action: mask
+//	    values: [kerfuffle, sharbert, fornax]
+//	  - kind: domain
+//	    action: reject
+//	    values: [spam.example]
+type File struct {
+	Rules []FileRule `yaml:"rules"`
+}
+
+type FileRule struct {
+	Kind   string   `yaml:"kind"`
+	Action Action   `yaml:"action"`
+	Values []string `yaml:"values"`
+}
+
+// DefaultRules are used when no rules file is configured.
+func DefaultRules() []Rule {
+	words, _ := NewWordList(Mask, "kerfuffle", "sharbert", "fornax")
+	return []Rule{words}
+}
+
+func LoadFile(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read moderation rules: %w", err)
+	}
+
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse moderation rules %s: %w", path, err)
+	}
+
+	var rules []Rule
+	for i, fr := range file.Rules {
+		built, err := NewRules(fr.Kind, fr.Action, fr.Values)
+		if err != nil {
+			return nil, fmt.Errorf("moderation rule %d in %s: %w", i+1, path, err)
+		}
+		rules = append(rules, built...)
+	}
+	return rules, nil
+}
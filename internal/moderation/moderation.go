@@ -0,0 +1,117 @@
+// Package moderation checks chirp bodies against a set of rules.
+//
+// Every rule reports the spans of the body it objects to together with what
+// should happen to them: masked, held for review or rejected outright. The
+// pipeline runs all rules, masks what it can and leaves it to the caller to
+// act on rejections and flags.
+package moderation
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Action string
+
+const (
+	Mask   Action = "mask"
+	Flag   Action = "flag"
+	Reject Action = "reject"
+)
+
+const maskText = "****"
+
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case Mask, Flag, Reject:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown action %q, expected mask, flag or reject", s)
+}
+
+// Finding is a span of the body a rule objects to. Start and End are byte
+// offsets into the body the pipeline was given, End exclusive.
+type Finding struct {
+	Kind   string
+	Value  string
+	Action Action
+	Start  int
+	End    int
+}
+
+// Rule identifies the rule behind the finding, such as "word:fornax".
+func (f Finding) Rule() string {
+	return f.Kind + ":" + f.Value
+}
+
+type Rule interface {
+	Check(body string) []Finding
+}
+
+type Result struct {
+	// Body has every masked span replaced.
+	Body     string
+	Findings []Finding
+}
+
+func (r Result) Rejected() bool {
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool { return f.Action == Reject })
+}
+
+func (r Result) Flagged() bool {
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool { return f.Action == Flag })
+}
+
+// Rules returns the distinct rules that produced findings with the given
+// action.
+func (r Result) Rules(action Action) []string {
+	var rules []string
+	for _, f := range r.Findings {
+		if f.Action == action && !slices.Contains(rules, f.Rule()) {
+			rules = append(rules, f.Rule())
+		}
+	}
+	return rules
+}
+
+type Pipeline struct {
+	rules []Rule
+}
+
+func NewPipeline(rules ...Rule) *Pipeline {
+	return &Pipeline{rules: rules}
+}
+
+// Moderate runs every rule over body. All rules see the original body, so
+// a masked word can still trip a regex that covers it.
+func (p *Pipeline) Moderate(body string) Result {
+	var findings []Finding
+	for _, rule := range p.rules {
+		findings = append(findings, rule.Check(body)...)
+	}
+
+	var masks []Finding
+	for _, f := range findings {
+		if f.Action == Mask {
+			masks = append(masks, f)
+		}
+	}
+	slices.SortFunc(masks, func(a, b Finding) int { return a.Start - b.Start })
+
+	var b strings.Builder
+	pos := 0
+	for _, m := range masks {
+		if m.Start < pos {
+			// Overlapping spans merge into a single mask.
+			pos = max(pos, m.End)
+			continue
+		}
+		b.WriteString(body[pos:m.Start])
+		b.WriteString(maskText)
+		pos = m.End
+	}
+	b.WriteString(body[pos:])
+
+	return Result{Body: b.String(), Findings: findings}
+}
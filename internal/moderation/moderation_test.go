@@ -0,0 +1,165 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func mustRules(t *testing.T, kind string, action Action, values ...string) []Rule {
+	t.Helper()
+	rules, err := NewRules(kind, action, values)
+	if err != nil {
+		t.Fatalf("NewRules(%q, %q, %q): %v", kind, action, values, err)
+	}
+	return rules
+}
+
+func TestWordList(t *testing.T) {
+	p := NewPipeline(mustRules(t, KindWord, Mask, "Kerfuffle", "fornax")...)
+
+	cases := []struct {
+		body string
+		want string
+	}{
+		{"say my name kerfuffle", "say my name ****"},
+		{"KERFUFFLE!  what a kerfuffle.", "****!  what a ****."},
+		{"ker-fuffle and (Fornax)", "**** and (****)"},
+		{"kerfuffled is fine", "kerfuffled is fine"},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		if got := p.Moderate(tc.body).Body; got != tc.want {
+			t.Errorf("Moderate(%q) = %q, want %q", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestRegex(t *testing.T) {
+	p := NewPipeline(mustRules(t, KindRegex, Flag, `(?i)buy now`)...)
+
+	res := p.Moderate("Buy Now while stocks last")
+	if !res.Flagged() || res.Rejected() {
+		t.Fatalf("Flagged = %v, Rejected = %v, want true, false", res.Flagged(), res.Rejected())
+	}
+	if res.Body != "Buy Now while stocks last" {
+		t.Errorf("Body = %q, flagging must not change it", res.Body)
+	}
+	if got := res.Rules(Flag); !slices.Equal(got, []string{"regex:(?i)buy now"}) {
+		t.Errorf("Rules(Flag) = %q", got)
+	}
+
+	if _, err := NewRules(KindRegex, Flag, []string{"("}); err == nil {
+		t.Error("invalid pattern was accepted")
+	}
+}
+
+func TestDomainBlocklist(t *testing.T) {
+	p := NewPipeline(mustRules(t, KindDomain, Reject, "Spam.example")...)
+
+	cases := []struct {
+		body   string
+		reject bool
+	}{
+		{"visit https://spam.example/deals now", true},
+		{"visit www.SPAM.example", true},
+		{"visit http://cdn.spam.example:8080/x?y=1", true},
+		{"visit notspam.example", false},
+		{"visit spam.example.org", false},
+		{"no links here.", false},
+	}
+	for _, tc := range cases {
+		if got := p.Moderate(tc.body).Rejected(); got != tc.reject {
+			t.Errorf("Moderate(%q).Rejected() = %v, want %v", tc.body, got, tc.reject)
+		}
+	}
+}
+
+func TestMaxMentions(t *testing.T) {
+	p := NewPipeline(mustRules(t, KindMaxMentions, Mask, "2")...)
+
+	res := p.Moderate("héllo @ann @bob @cat @dan")
+	if res.Body != "héllo @ann @bob **** ****" {
+		t.Errorf("Body = %q", res.Body)
+	}
+	if res := p.Moderate("@ann @bob"); len(res.Findings) != 0 {
+		t.Errorf("Findings = %v, want none at the limit", res.Findings)
+	}
+
+	if _, err := NewRules(KindMaxMentions, Reject, []string{"-1"}); err == nil {
+		t.Error("negative limit was accepted")
+	}
+}
+
+func TestPipelineCombinesActions(t *testing.T) {
+	var rules []Rule
+	rules = append(rules, mustRules(t, KindWord, Mask, "fornax")...)
+	rules = append(rules, mustRules(t, KindRegex, Mask, `for\w+ is`)...)
+	rules = append(rules, mustRules(t, KindWord, Reject, "spam")...)
+	p := NewPipeline(rules...)
+
+	res := p.Moderate("fornax is here")
+	if res.Body != "**** here" {
+		t.Errorf("overlapping masks: Body = %q", res.Body)
+	}
+	if res.Rejected() {
+		t.Error("Rejected without a reject rule matching")
+	}
+	if !p.Moderate("fornax spam").Rejected() {
+		t.Error("reject rule did not reject")
+	}
+}
+
+func TestNewRulesValidation(t *testing.T) {
+	bad := []struct {
+		kind   string
+		action Action
+		values []string
+	}{
+		{"colour", Mask, []string{"red"}},
+		{KindWord, "delete", []string{"red"}},
+		{KindWord, Mask, []string{"!!!"}},
+		{KindDomain, Mask, []string{"http://x.example"}},
+	}
+	for _, tc := range bad {
+		if _, err := NewRules(tc.kind, tc.action, tc.values); err == nil {
+			t.Errorf("NewRules(%q, %q, %q) succeeded", tc.kind, tc.action, tc.values)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	data := `
+rules:
+  - kind: word
+    action: mask
+    values: [darn]
+  - kind: domain
+    action: reject
+    values: [spam.example]
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	p := NewPipeline(rules...)
+	if got := p.Moderate("darn it").Body; got != "**** it" {
+		t.Errorf("Body = %q", got)
+	}
+	if !p.Moderate("see spam.example").Rejected() {
+		t.Error("domain rule from file did not reject")
+	}
+
+	if err := os.WriteFile(path, []byte("rules:\n  - kind: word\n    action: nuke\n    values: [x]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("LoadFile accepted an unknown action")
+	}
+}
@@ -0,0 +1,276 @@
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/entities"
+)
+
+const (
+	KindWord        = "word"
+	KindRegex       = "regex"
+	KindDomain      = "domain"
+	KindMaxMentions = "max_mentions"
+)
+
+// NewRules builds the rules for a list of values of one kind. Words and
+// domains share a single rule; patterns and limits get one each.
+func NewRules(kind string, action Action, values []string) ([]Rule, error) {
+	if _, err := ParseAction(string(action)); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case KindWord:
+		rule, err := NewWordList(action, values...)
+		if err != nil {
+			return nil, err
+		}
+		return []Rule{rule}, nil
+	case KindDomain:
+		rule, err := NewDomainBlocklist(action, values...)
+		if err != nil {
+			return nil, err
+		}
+		return []Rule{rule}, nil
+	case KindRegex:
+		var rules []Rule
+		for _, v := range values {
+			rule, err := NewRegex(action, v)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
+		return rules, nil
+	case KindMaxMentions:
+		var rules []Rule
+		for _, v := range values {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				return nil, fmt.Errorf("max_mentions %q must be a non-negative integer", v)
+			}
+			rules = append(rules, NewMaxMentions(action, limit))
+		}
+		return rules, nil
+	}
+	return nil, fmt.Errorf("unknown rule kind %q, expected word, regex, domain or max_mentions", kind)
+}
+
+// WordList matches words regardless of case and punctuation, so
+// "Kerfuffle!" and "ker-fuffle" both match "kerfuffle". Only the word is
+// masked; surrounding punctuation stays.
+type WordList struct {
+	action Action
+	words  map[string]bool
+}
+
+func NewWordList(action Action, words ...string) (*WordList, error) {
+	w := &WordList{action: action, words: make(map[string]bool)}
+	for _, word := range words {
+		normalized := normalizeWord(word)
+		if normalized == "" {
+			return nil, fmt.Errorf("word %q has no letters or digits", word)
+		}
+		w.words[normalized] = true
+	}
+	return w, nil
+}
+
+func (w *WordList) Check(body string) []Finding {
+	var findings []Finding
+	start := -1
+	check := func(end int) {
+		field := body[start:end]
+		word := normalizeWord(field)
+		if w.words[word] {
+			// Trim the punctuation around the word from the span.
+			first := strings.IndexFunc(field, isWordRune)
+			last := strings.LastIndexFunc(field, isWordRune)
+			_, size := lastRune(field[last:])
+			findings = append(findings, Finding{
+				Kind:   KindWord,
+				Value:  word,
+				Action: w.action,
+				Start:  start + first,
+				End:    start + last + size,
+			})
+		}
+		start = -1
+	}
+
+	for i, r := range body {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				check(i)
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		check(len(body))
+	}
+	return findings
+}
+
+type Regex struct {
+	action  Action
+	pattern *regexp.Regexp
+}
+
+// NewRegex compiles pattern with Go's regexp syntax. Use (?i) for a
+// case-insensitive match.
+func NewRegex(action Action, pattern string) (*Regex, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return &Regex{action: action, pattern: re}, nil
+}
+
+func (r *Regex) Check(body string) []Finding {
+	var findings []Finding
+	for _, loc := range r.pattern.FindAllStringIndex(body, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:   KindRegex,
+			Value:  r.pattern.String(),
+			Action: r.action,
+			Start:  loc[0],
+			End:    loc[1],
+		})
+	}
+	return findings
+}
+
+// linkPattern finds URLs and bare domains such as example.com/path.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://)?(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}\b(?:[/?#:][^\s]*)?`)
+
+// DomainBlocklist matches links to a blocked domain or any of its
+// subdomains.
+type DomainBlocklist struct {
+	action  Action
+	domains []string
+}
+
+func NewDomainBlocklist(action Action, domains ...string) (*DomainBlocklist, error) {
+	d := &DomainBlocklist{action: action}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		if domain == "" || strings.ContainsAny(domain, "/: ") {
+			return nil, fmt.Errorf("%q is not a domain", domain)
+		}
+		d.domains = append(d.domains, domain)
+	}
+	return d, nil
+}
+
+func (d *DomainBlocklist) Check(body string) []Finding {
+	var findings []Finding
+	for _, loc := range linkPattern.FindAllStringIndex(body, -1) {
+		host, err := linkHost(body[loc[0]:loc[1]])
+		if err != nil {
+			continue
+		}
+		for _, domain := range d.domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				findings = append(findings, Finding{
+					Kind:   KindDomain,
+					Value:  domain,
+					Action: d.action,
+					Start:  loc[0],
+					End:    loc[1],
+				})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+func linkHost(link string) (string, error) {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("link has no host")
+	}
+	return strings.ToLower(u.Hostname()), nil
+}
+
+// MaxMentions objects to every mention past the first limit.
+type MaxMentions struct {
+	action Action
+	limit  int
+}
+
+func NewMaxMentions(action Action, limit int) *MaxMentions {
+	return &MaxMentions{action: action, limit: limit}
+}
+
+func (m *MaxMentions) Check(body string) []Finding {
+	var mentions []entities.Entity
+	for _, e := range entities.Parse(body) {
+		if e.Type == entities.Mention {
+			mentions = append(mentions, e)
+		}
+	}
+	if len(mentions) <= m.limit {
+		return nil
+	}
+
+	// Entity offsets count code points; findings use bytes.
+	offsets := make([]int, 0, len(body)+1)
+	for i := range body {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(body))
+
+	var findings []Finding
+	for _, e := range mentions[m.limit:] {
+		findings = append(findings, Finding{
+			Kind:   KindMaxMentions,
+			Value:  strconv.Itoa(m.limit),
+			Action: m.action,
+			Start:  offsets[e.Start],
+			End:    offsets[e.End],
+		})
+	}
+	return findings
+}
+
+func normalizeWord(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if isWordRune(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func lastRune(s string) (rune, int) {
+	for _, r := range s {
+		return r, len(string(r))
+	}
+	return 0, 0
+}
@@ -0,0 +1,297 @@
+// Package search parses the chirp search syntax.
+//
+// A query is made of words, "quoted phrases", -excluded words or phrases and
+// the operators from:<handle>, since:<date> and until:<date>. Dates are
+// YYYY-MM-DD in UTC or RFC 3339 timestamps. Parsing happens here rather than
+// in PostgreSQL so operators can become query filters and bad input can be
+// rejected before it reaches the database.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/entities"
+)
+
+const dateLayout = "2006-01-02"
+
+var ErrEmptyQuery = errors.New("search query is empty")
+
+type Query struct {
+	// Terms and Phrases must all appear in a matching chirp; Excluded
+	// words and phrases must not.
+	Terms    []string
+	Phrases  []string
+	Excluded []string
+
+	// From is the normalised handle of the author, if any.
+	From string
+	// Since is inclusive and Until exclusive. A date-only until: covers
+	// that whole day, so Until is the following midnight.
+	Since time.Time
+	Until time.Time
+}
+
+// Parse parses a search query. Words are lowercased and an unterminated
+// quote runs to the end of the query. A query with nothing to search for
+// returns ErrEmptyQuery.
+func Parse(s string) (Query, error) {
+	var q Query
+
+	for _, tok := range tokenize(s) {
+		if !tok.quoted && !tok.negated {
+			if op, value, ok := strings.Cut(tok.text, ":"); ok {
+				handled, err := q.setOperator(strings.ToLower(op), value)
+				if err != nil {
+					return Query{}, err
+				}
+				if handled {
+					continue
+				}
+			}
+		}
+
+		// Punctuation is dropped so "cook," searches for "cook" and stray
+		// characters can't reach websearch_to_tsquery. Hyphenated words
+		// become phrases.
+		words := Words(tok.text)
+		if len(words) == 0 {
+			continue
+		}
+		text := strings.Join(words, " ")
+
+		switch {
+		case tok.negated:
+			q.Excluded = append(q.Excluded, text)
+		case tok.quoted || len(words) > 1:
+			q.Phrases = append(q.Phrases, text)
+		default:
+			q.Terms = append(q.Terms, text)
+		}
+	}
+
+	if q.IsEmpty() {
+		return Query{}, ErrEmptyQuery
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return Query{}, errors.New("since: must be before until:")
+	}
+	return q, nil
+}
+
+// setOperator applies a from:, since: or until: operator. It reports false
+// for anything else so the token is searched for as text.
+func (q *Query) setOperator(op, value string) (bool, error) {
+	switch op {
+	case "from":
+		handle, ok := entities.NormalizeHandle(value)
+		if !ok {
+			return false, fmt.Errorf("from: %q is not a handle", value)
+		}
+		q.From = handle
+	case "since":
+		t, err := parseTime(value, false)
+		if err != nil {
+			return false, fmt.Errorf("since: %w", err)
+		}
+		q.Since = t
+	case "until":
+		t, err := parseTime(value, true)
+		if err != nil {
+			return false, fmt.Errorf("until: %w", err)
+		}
+		q.Until = t
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// IsEmpty reports whether the query has neither text nor operators.
+func (q Query) IsEmpty() bool {
+	return !q.HasText() && q.From == "" && q.Since.IsZero() && q.Until.IsZero()
+}
+
+// HasText reports whether the query searches the chirp body at all.
+func (q Query) HasText() bool {
+	return len(q.Terms) > 0 || len(q.Phrases) > 0 || len(q.Excluded) > 0
+}
+
+// Text renders the words and phrases in the syntax understood by
+// PostgreSQL's websearch_to_tsquery. Operators are left out; they are
+// applied as separate filters.
+func (q Query) Text() string {
+	parts := append([]string{}, q.Terms...)
+	for _, p := range q.Phrases {
+		parts = append(parts, `"`+p+`"`)
+	}
+	for _, e := range q.Excluded {
+		if strings.Contains(e, " ") {
+			parts = append(parts, `-"`+e+`"`)
+		} else {
+			parts = append(parts, "-"+e)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Match reports whether body satisfies the text part of the query. It
+// compares whole words case-insensitively and, unlike PostgreSQL, does no
+// stemming; it backs the in-memory store.
+func (q Query) Match(body string) bool {
+	words := Words(body)
+	for _, t := range q.Terms {
+		if indexWords(words, []string{t}) < 0 {
+			return false
+		}
+	}
+	for _, p := range q.Phrases {
+		if indexWords(words, Words(p)) < 0 {
+			return false
+		}
+	}
+	for _, e := range q.Excluded {
+		if indexWords(words, Words(e)) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Highlight HTML-escapes body and wraps the words the query matched in
+// <mark> tags.
+func (q Query) Highlight(body string) string {
+	marked := make(map[string]bool)
+	for _, t := range q.Terms {
+		marked[t] = true
+	}
+	for _, p := range q.Phrases {
+		for _, w := range Words(p) {
+			marked[w] = true
+		}
+	}
+
+	var b strings.Builder
+	start := -1
+	flush := func(end int) {
+		word := body[start:end]
+		if marked[strings.ToLower(word)] {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		start = -1
+	}
+	for i, r := range body {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			flush(i)
+		}
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	if start >= 0 {
+		flush(len(body))
+	}
+	return b.String()
+}
+
+// Words splits s into lowercased words.
+func Words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !isWordRune(r) })
+}
+
+func indexWords(words, seq []string) int {
+	if len(seq) == 0 {
+		return -1
+	}
+	for i := 0; i+len(seq) <= len(words); i++ {
+		found := true
+		for j := range seq {
+			if words[i+j] != seq[j] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return i
+		}
+	}
+	return -1
+}
+
+type token struct {
+	text    string
+	quoted  bool
+	negated bool
+}
+
+// tokenize splits s on whitespace, keeping quoted phrases together. A
+// leading '-' negates the token.
+func tokenize(s string) []token {
+	var tokens []token
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var tok token
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			tok.negated = true
+			i++
+		}
+
+		end := i
+		if runes[i] == '"' {
+			tok.quoted = true
+			i++
+			end = i
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+		} else {
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+		}
+
+		tok.text = string(runes[i:end])
+		tokens = append(tokens, tok)
+		i = end
+		if tok.quoted {
+			// Skip the closing quote.
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, value); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date", value)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
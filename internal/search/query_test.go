@@ -0,0 +1,120 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  Query
+	}{
+		{"words", "Blue Sky", Query{Terms: []string{"blue", "sky"}}},
+		{"phrase", `"say my name" walt`, Query{Terms: []string{"walt"}, Phrases: []string{"say my name"}}},
+		{"exclusion", "cook -meth -\"blue sky\"", Query{Terms: []string{"cook"}, Excluded: []string{"meth", "blue sky"}}},
+		{"punctuation", "cook, now!", Query{Terms: []string{"cook", "now"}}},
+		{"hyphenated", "well-known", Query{Phrases: []string{"well known"}}},
+		{"unterminated quote", `"say my`, Query{Phrases: []string{"say my"}}},
+		{"from", "from:@Walt science", Query{Terms: []string{"science"}, From: "walt"}},
+		{"only operators", "from:walt", Query{From: "walt"}},
+		{
+			"dates",
+			"since:2024-01-02 until:2024-01-31 cook",
+			Query{
+				Terms: []string{"cook"},
+				Since: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+				Until: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{"timestamp", "since:2024-01-02T10:00:00+02:00", Query{Since: time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)}},
+		{"unknown operator", "http://example.com", Query{Phrases: []string{"http example com"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tc.query, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Parse(%q) = %+v, want %+v", tc.query, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"empty", ""},
+		{"only punctuation", "!! ,"},
+		{"bad date", "since:yesterday cook"},
+		{"bad handle", "from:not-a-handle"},
+		{"backwards range", "since:2024-02-01 until:2024-01-01"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse(tc.query); err == nil {
+				t.Fatalf("Parse(%q) expected an error", tc.query)
+			}
+		})
+	}
+
+	if _, err := Parse("  "); !errors.Is(err, ErrEmptyQuery) {
+		t.Fatalf("expected ErrEmptyQuery, got %v", err)
+	}
+}
+
+func TestText(t *testing.T) {
+	q, err := Parse(`cook "blue sky" -meth -"say my name" from:walt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `cook "blue sky" -meth -"say my name"`
+	if got := q.Text(); got != want {
+		t.Fatalf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	q, err := Parse(`cook "blue sky" -meth`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{"We cook the Blue Sky", true},
+		{"we cook the sky blue", false},
+		{"cook blue sky meth", false},
+		{"cooking blue sky", false},
+	}
+
+	for _, tc := range tests {
+		if got := q.Match(tc.body); got != tc.want {
+			t.Errorf("Match(%q) = %v, want %v", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	q, err := Parse("cook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<mark>Cook</mark> &lt;now&gt;"
+	if got := q.Highlight("Cook <now>"); got != want {
+		t.Fatalf("Highlight() = %q, want %q", got, want)
+	}
+}
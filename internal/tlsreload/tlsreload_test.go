@@ -0,0 +1,133 @@
+package tlsreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCert(t *testing.T, certFile, keyFile string, serial int64, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("writing certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+
+	// Pin the modification time so the test doesn't depend on the
+	// filesystem's timestamp resolution.
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatalf("setting modification time: %v", err)
+		}
+	}
+}
+
+func serial(t *testing.T, r *Reloader) int64 {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate returned error: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	writeCert(t, certFile, keyFile, 1, start)
+
+	r, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if got := serial(t, r); got != 1 {
+		t.Fatalf("expected serial 1, got %d", got)
+	}
+
+	reloaded, err := r.reloadIfChanged()
+	if err != nil || reloaded {
+		t.Fatalf("expected no reload for unchanged files, got reloaded=%v err=%v", reloaded, err)
+	}
+
+	writeCert(t, certFile, keyFile, 2, start.Add(time.Second))
+
+	reloaded, err = r.reloadIfChanged()
+	if err != nil || !reloaded {
+		t.Fatalf("expected a reload after the files changed, got reloaded=%v err=%v", reloaded, err)
+	}
+	if got := serial(t, r); got != 2 {
+		t.Fatalf("expected serial 2 after reload, got %d", got)
+	}
+}
+
+func TestBrokenPairKeepsPreviousCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	writeCert(t, certFile, keyFile, 1, start)
+
+	r, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+
+	if _, err := r.reloadIfChanged(); err == nil {
+		t.Fatalf("expected an error for a broken key file")
+	}
+	if got := serial(t, r); got != 1 {
+		t.Fatalf("expected the previous certificate to stay in use, got serial %d", got)
+	}
+}
+
+func TestNewFailsForMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := New(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err == nil {
+		t.Fatalf("expected an error for missing files")
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type LikeResponse struct {
+	ID      uuid.UUID `json:"id"`
+	Handle  string    `json:"handle,omitempty"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+type RechirpResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle,omitempty"`
+	RechirpedAt time.Time `json:"rechirped_at"`
+}
+
+// pathChirp resolves the {chirpID} path value to a chirp that hasn't been
+// deleted and that the caller may see. On failure the error response has
+// already been sent.
+func (cfg *apiConfig) pathChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		requestLogger(r).Info("transforming uuid", "err", err)
+		respondWithError(w, errChirpNotFound)
+		return database.Chirp{}, false
+	}
+
+	chirp, err := cfg.queries.GetChirp(r.Context(), id)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		requestLogger(r).Info("getting chirp", "err", err)
+		respondWithError(w, errChirpNotFound)
+		return database.Chirp{}, false
+	}
+
+	if !cfg.canView(r, chirp) {
+		requestLogger(r).Info("chirp is hidden", "chirp_id", chirp.ID)
+		respondWithError(w, errChirpNotFound)
+		return database.Chirp{}, false
+	}
+
+	return chirp, true
+}
+
+// viewer returns the caller for endpoints that work without logging in.
+// A missing Authorization header is anonymous, but a bad token is still
+// rejected. On failure the error response has already been sent.
+func (cfg *apiConfig) viewer(w http.ResponseWriter, r *http.Request) (uuid.NullUUID, bool) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}, true
+	}
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return uuid.NullUUID{}, false
+	}
+	return uuid.NullUUID{UUID: user_id, Valid: true}, true
+}
+
+func chirpRefs(chirps []ChirpResponse) []*ChirpResponse {
+	refs := make([]*ChirpResponse, 0, len(chirps))
+	for i := range chirps {
+		refs = append(refs, &chirps[i])
+	}
+	return refs
+}
+
+// setViewerState fills in liked_by_me and rechirped_by_me for an
+// authenticated viewer, with one query per flag for the whole page.
+func (cfg *apiConfig) setViewerState(ctx context.Context, viewer uuid.NullUUID, chirps ...*ChirpResponse) error {
+	if !viewer.Valid || len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+	}
+
+	liked, err := cfg.queries.ListLikedChirpIDs(ctx, database.ListLikedChirpIDsParams{
+		UserID:   viewer.UUID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	rechirped, err := cfg.queries.ListRechirpedChirpIDs(ctx, database.ListRechirpedChirpIDsParams{
+		UserID:   viewer.UUID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range chirps {
+		likedByMe := slices.Contains(liked, c.ID)
+		rechirpedByMe := slices.Contains(rechirped, c.ID)
+		c.LikedByMe = &likedByMe
+		c.RechirpedByMe = &rechirpedByMe
+	}
+	return nil
+}
+
+func (cfg *apiConfig) likeEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.canInteract(w, r, user_id) {
+		return
+	}
+
+	chirp, ok := cfg.pathChirp(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.queries.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  user_id,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		requestLogger(r).Error("liking chirp", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unlikeEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	chirp, ok := cfg.pathChirp(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.queries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  user_id,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		requestLogger(r).Error("unliking chirp", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) rechirpEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.canInteract(w, r, user_id) {
+		return
+	}
+
+	chirp, ok := cfg.pathChirp(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.queries.RechirpChirp(r.Context(), database.RechirpChirpParams{
+		UserID:  user_id,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		requestLogger(r).Error("rechirping chirp", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unrechirpEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	chirp, ok := cfg.pathChirp(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.queries.UnrechirpChirp(r.Context(), database.UnrechirpChirpParams{
+		UserID:  user_id,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		requestLogger(r).Error("unrechirping chirp", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) get_likesEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	chirp, ok := cfg.pathChirp(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	rows, err := cfg.queries.ListChirpLikes(r.Context(), database.ListChirpLikesParams{
+		ChirpID:         chirp.ID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("listing likes", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	likes := make([]LikeResponse, 0, len(rows))
+	for _, row := range rows {
+		likes = append(likes, LikeResponse{ID: row.ID, Handle: row.Handle.String, LikedAt: row.LikedAt})
+	}
+
+	if len(likes) > 0 {
+		last := likes[len(likes)-1]
+		setNextLink(w, r, page, len(likes), pageCursor{CreatedAt: last.LikedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, likes)
+}
+
+func (cfg *apiConfig) get_rechirpsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	chirp, ok := cfg.pathChirp(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	rows, err := cfg.queries.ListChirpRechirps(r.Context(), database.ListChirpRechirpsParams{
+		ChirpID:         chirp.ID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("listing rechirps", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	rechirps := make([]RechirpResponse, 0, len(rows))
+	for _, row := range rows {
+		rechirps = append(rechirps, RechirpResponse{ID: row.ID, Handle: row.Handle.String, RechirpedAt: row.RechirpedAt})
+	}
+
+	if len(rechirps) > 0 {
+		last := rechirps[len(rechirps)-1]
+		setNextLink(w, r, page, len(rechirps), pageCursor{CreatedAt: last.RechirpedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, rechirps)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+)
+
+// loginFailureWindow is how long failed logins are remembered after the
+// last one.
+const loginFailureWindow = time.Hour
+
+// loginThrottle locks a key out once it has failed freeAttempts logins in a
+// row. Each failure after that doubles the lockout, up to maxLockout.
+type loginThrottle struct {
+	name         string
+	freeAttempts int32
+	baseLockout  time.Duration
+	maxLockout   time.Duration
+}
+
+var (
+	accountThrottle = loginThrottle{name: "account", freeAttempts: 5, baseLockout: 30 * time.Second, maxLockout: 15 * time.Minute}
+	// ipThrottle allows more attempts, since several people can share an
+	// address.
+	ipThrottle = loginThrottle{name: "ip", freeAttempts: 20, baseLockout: 30 * time.Second, maxLockout: 15 * time.Minute}
+)
+
+func (t loginThrottle) key(id string) string {
+	return t.name + ":" + id
+}
+
+func (t loginThrottle) lockout(failures int32) time.Duration {
+	if failures < t.freeAttempts {
+		return 0
+	}
+	lockout := float64(t.baseLockout) * math.Pow(2, float64(failures-t.freeAttempts))
+	return time.Duration(min(lockout, float64(t.maxLockout)))
+}
+
+type throttledKey struct {
+	throttle loginThrottle
+	key      string
+}
+
+// loginKeys are the keys a login for email from r counts against. The
+// account key is the email rather than the user, so unknown emails lock out
+// the same way and a 429 doesn't tell which accounts exist.
+func loginKeys(r *http.Request, email string) []throttledKey {
+	return []throttledKey{
+		{accountThrottle, accountKey(email)},
+		{ipThrottle, ipThrottle.key(clientIP(r))},
+	}
+}
+
+func accountKey(email string) string {
+	return accountThrottle.key(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// checkLoginThrottle responds with 429 when the account or the client's
+// address is locked out. On failure the error response has already been
+// sent.
+func (cfg *apiConfig) checkLoginThrottle(w http.ResponseWriter, r *http.Request, email string) bool {
+	var wait time.Duration
+	for _, k := range loginKeys(r, email) {
+		retryAfter, err := cfg.queries.GetLoginLockout(r.Context(), k.key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			requestLogger(r).Error("getting login lockout", "err", err)
+			respondWithError(w, errInternal)
+			return false
+		}
+		wait = max(wait, time.Duration(retryAfter*float64(time.Second)))
+	}
+
+	if wait <= 0 {
+		return true
+	}
+
+	requestLogger(r).Info("login locked out", "retry_after", wait)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, errTooManyLogins)
+	return false
+}
+
+// recordLoginFailure counts a failed login and locks out the keys that are
+// over their limit. Errors are only logged; the caller still answers 401.
+func (cfg *apiConfig) recordLoginFailure(r *http.Request, email string) {
+	for _, k := range loginKeys(r, email) {
+		failures, err := cfg.queries.RecordLoginFailure(r.Context(), database.RecordLoginFailureParams{
+			Key:           k.key,
+			WindowSeconds: loginFailureWindow.Seconds(),
+		})
+		if err != nil {
+			requestLogger(r).Error("recording login failure", "err", err)
+			continue
+		}
+
+		lockout := k.throttle.lockout(failures)
+		if lockout == 0 {
+			continue
+		}
+
+		requestLogger(r).Warn("locking out logins", "throttle", k.throttle.name, "failures", failures, "lockout", lockout)
+		err = cfg.queries.LockLogin(r.Context(), database.LockLoginParams{
+			Key:            k.key,
+			LockoutSeconds: lockout.Seconds(),
+		})
+		if err != nil {
+			requestLogger(r).Error("locking out logins", "err", err)
+		}
+	}
+}
+
+// clearLoginFailures forgets an account's failed logins once it has signed
+// in. The address keeps its count, so one working account can't be used to
+// reset it.
+func (cfg *apiConfig) clearLoginFailures(r *http.Request, email string) {
+	if err := cfg.queries.ClearLoginThrottle(r.Context(), accountKey(email)); err != nil {
+		requestLogger(r).Error("clearing login failures", "err", err)
+	}
+}
+
+// unlock_userEndpoint lifts an account's lockout before it runs out.
+func (cfg *apiConfig) unlock_userEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.queries.ClearLoginThrottle(r.Context(), accountKey(user.Email)); err != nil {
+		requestLogger(r).Error("clearing login throttle", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	requestLogger(r).Info("unlocked account", "user_id", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/config"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+type requestLogKey struct{}
+
+// requestLog is the per-request logging state. Handlers reach it through
+// requestLogger and setRequestUser.
+type requestLog struct {
+	logger *slog.Logger
+	userID uuid.NullUUID
+}
+
+func newLogger(c config.LogConfig, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: c.SlogLevel()}
+	if c.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// requestLogger returns the logger for r, tagged with its request ID and,
+// once known, the authenticated user.
+func requestLogger(r *http.Request) *slog.Logger {
+	if rl, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// setRequestUser records who made the request for the rest of its log lines
+// and the access log.
+func setRequestUser(r *http.Request, userID uuid.UUID) {
+	rl, ok := r.Context().Value(requestLogKey{}).(*requestLog)
+	if !ok || rl.userID.Valid {
+		return
+	}
+	rl.userID = uuid.NullUUID{UUID: userID, Valid: true}
+	rl.logger = rl.logger.With("user_id", userID)
+}
+
+// validRequestID accepts IDs from upstream proxies as long as they are short
+// and can't break a log line.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func (cfg *apiConfig) middlewareLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		rl := &requestLog{logger: cfg.logger.With("request_id", requestID)}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl))
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		// rl.logger already carries the request and user IDs.
+		rl.logger.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("route", r.Pattern),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
@@ -3,40 +3,135 @@ package main
 import _ "github.com/lib/pq"
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/config"
 	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/events"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/mail"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/memstore"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/migrate"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/moderation"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/tlsreload"
 	"github.com/joho/godotenv"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+const tlsReloadInterval = 30 * time.Second
+
 type apiConfig struct {
 	fileserverHits atomic.Int32
-	queries        *database.Queries
+	queries        database.Querier
 	platform       string
 	secret         string
+	polkaKey       string
+	moderation     *moderator
+	mailer         mail.Mailer
+	publicURL      string
+	// requireVerifiedEmail blocks unverified accounts from posting.
+	requireVerifiedEmail bool
+	events               *events.Broker
+	// background tracks work that outlives its request, like mail sent
+	// after answering. Shutdown waits for it.
+	background sync.WaitGroup
+	metrics    *serverMetrics
+	logger     *slog.Logger
 }
 
 func run() error {
+	// The .env file is a convenience for local development; in other
+	// environments settings come from the real environment or a config file.
 	err := godotenv.Load()
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	cfg, args, err := config.Load(os.Args[1:], os.Stderr)
 	if err != nil {
 		return err
 	}
-	dbQueries := database.New(db)
 
-	apiCfg := apiConfig{
-		queries:  dbQueries,
-		platform: os.Getenv("PLATFORM"),
-		secret:   os.Getenv("SECRET"),
+	if len(args) > 0 {
+		return runCommand(cfg, args)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// The standard log package is routed through this logger too, so the
+	// remaining log.Print calls share its format.
+	logger := newLogger(cfg.Log, os.Stderr)
+	slog.SetDefault(logger)
+
+	apiCfg := &apiConfig{
+		platform: cfg.Platform,
+		secret:   cfg.Secret,
+		polkaKey: cfg.PolkaKey,
+		events:   events.NewBroker(streamReplaySize),
+		logger:   logger,
+
+		publicURL:            cfg.PublicURL,
+		requireVerifiedEmail: cfg.RequireVerifiedEmail,
+	}
+	apiCfg.metrics = apiCfg.newServerMetrics()
+
+	rules := moderation.DefaultRules()
+	if cfg.Moderation.RulesFile != "" {
+		rules, err = moderation.LoadFile(cfg.Moderation.RulesFile)
+		if err != nil {
+			return err
+		}
+	}
+	apiCfg.moderation = newModerator(rules)
+
+	switch cfg.Mail.Backend {
+	case "smtp":
+		apiCfg.mailer = &mail.SMTP{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			From:     cfg.Mail.From,
+		}
+	case "outbox":
+		slog.Warn("Mail is not delivered, using the outbox", "dir", cfg.Mail.OutboxDir)
+		apiCfg.mailer = &mail.Outbox{Dir: cfg.Mail.OutboxDir, From: cfg.Mail.From}
+	}
+
+	switch cfg.Database.Backend {
+	case "postgres":
+		db, err := sql.Open("postgres", cfg.Database.URL)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if cfg.Database.AutoMigrate {
+			slog.Info("Applying database migrations")
+			if err := migrate.Up(context.Background(), db, log.Writer()); err != nil {
+				return fmt.Errorf("migrating database: %w", err)
+			}
+		}
+
+		apiCfg.metrics.registerDBStats(db)
+		apiCfg.queries = database.New(apiCfg.metrics.instrumentDB(db))
+	case "memory":
+		slog.Warn("Using in-memory storage, all data is lost on restart")
+		apiCfg.queries = memstore.New()
 	}
 
 	filepathRoot, err := os.Getwd()
@@ -44,34 +139,128 @@ func run() error {
 		return err
 	}
 
-	fileSystem := http.FileServer(http.Dir((filepathRoot)))
+	serverCfg := cfg.Server
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	DefaultServeMux := http.NewServeMux()
-	DefaultServeMux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app/", fileSystem)))
-	DefaultServeMux.HandleFunc("GET /api/healthz", readinessEndpoint)
-	DefaultServeMux.HandleFunc("GET /admin/metrics", apiCfg.hitsEndpoint)
-	DefaultServeMux.HandleFunc("POST /admin/reset", apiCfg.resetEndpoint)
-	DefaultServeMux.HandleFunc("POST /api/users", apiCfg.create_userEndpoint)
-	DefaultServeMux.HandleFunc("POST /api/chirps", apiCfg.create_chirpEndpoint)
-	DefaultServeMux.HandleFunc("GET /api/chirps", apiCfg.get_chirpsEndpoint)
-	DefaultServeMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.get_chirpEndpoint)
-	DefaultServeMux.HandleFunc("POST /api/login", apiCfg.loginEndpoint)
-	DefaultServeMux.HandleFunc("POST /api/refresh", apiCfg.refreshEndpoint)
-	DefaultServeMux.HandleFunc("POST /api/revoke", apiCfg.revokeEndpoint)
-	DefaultServeMux.HandleFunc("PUT /api/users", apiCfg.update_passwordEndpoint)
-	DefaultServeMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.delete_chirpEndpoint)
-
-	port := "8080"
 	s := &http.Server{
-		Addr:    ":" + port,
-		Handler: DefaultServeMux,
+		Addr:              serverCfg.Addr,
+		Handler:           apiCfg.routes(filepathRoot),
+		ReadTimeout:       serverCfg.ReadTimeout,
+		ReadHeaderTimeout: serverCfg.ReadHeaderTimeout,
+		WriteTimeout:      serverCfg.WriteTimeout,
+		IdleTimeout:       serverCfg.IdleTimeout,
+		MaxHeaderBytes:    serverCfg.MaxHeaderBytes,
 	}
+	// Event streams only end when the broker closes, so close it as soon as
+	// shutdown starts instead of waiting out the deadline.
+	s.RegisterOnShutdown(apiCfg.events.Close)
 
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(s.ListenAndServe())
+	serveErr := make(chan error, 1)
+	if serverCfg.TLSCertFile != "" {
+		reloader, err := tlsreload.New(serverCfg.TLSCertFile, serverCfg.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		go reloader.Watch(ctx, tlsReloadInterval)
+
+		s.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+
+		slog.Info("Serving files", "root", filepathRoot, "addr", serverCfg.Addr, "tls", true)
+		go func() { serveErr <- s.ListenAndServeTLS("", "") }()
+	} else {
+		slog.Info("Serving files", "root", filepathRoot, "addr", serverCfg.Addr, "tls", false)
+		go func() { serveErr <- s.ListenAndServe() }()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, draining requests", "timeout", serverCfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverCfg.ShutdownTimeout)
+	defer cancel()
+
+	err = s.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Whatever didn't finish in time, such as a stream ignoring its
+		// context, is cut off rather than left running.
+		slog.Warn("Shutdown timed out, closing remaining connections")
+		err = s.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("shutting down server: %w", err)
+	}
+
+	apiCfg.background.Wait()
 	return nil
 }
 
+func (cfg *apiConfig) routes(filepathRoot string) http.Handler {
+	fileSystem := http.FileServer(http.Dir((filepathRoot)))
+
+	DefaultServeMux := http.NewServeMux()
+	DefaultServeMux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app/", fileSystem)))
+	DefaultServeMux.HandleFunc("GET /api/healthz", readinessEndpoint)
+	DefaultServeMux.Handle("GET /admin/metrics", cfg.requireRole(auth.RoleAdmin, cfg.hitsEndpoint))
+	DefaultServeMux.Handle("POST /admin/reset", cfg.requireRole(auth.RoleAdmin, cfg.resetEndpoint))
+	DefaultServeMux.Handle("GET /admin/moderation/rules", cfg.requireRole(auth.RoleModerator, cfg.get_moderation_rulesEndpoint))
+	DefaultServeMux.Handle("POST /admin/moderation/rules", cfg.requireRole(auth.RoleModerator, cfg.create_moderation_ruleEndpoint))
+	DefaultServeMux.Handle("DELETE /admin/moderation/rules/{ruleID}", cfg.requireRole(auth.RoleModerator, cfg.delete_moderation_ruleEndpoint))
+	DefaultServeMux.Handle("GET /admin/moderation/queue", cfg.requireRole(auth.RoleModerator, cfg.get_moderation_queueEndpoint))
+	DefaultServeMux.Handle("POST /admin/moderation/{id}/resolve", cfg.requireRole(auth.RoleModerator, cfg.resolve_moderationEndpoint))
+	DefaultServeMux.Handle("POST /admin/users/{userID}/unlock", cfg.requireRole(auth.RoleAdmin, cfg.unlock_userEndpoint))
+	DefaultServeMux.HandleFunc("POST /api/users", cfg.create_userEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/chirps", cfg.create_chirpEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/chirps", cfg.get_chirpsEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/chirps/stream", cfg.stream_chirpsEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/chirps/{chirpID}", cfg.get_chirpEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/login", cfg.loginEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/login/2fa", cfg.login_two_factorEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/refresh", cfg.refreshEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/revoke", cfg.revokeEndpoint)
+	DefaultServeMux.HandleFunc("PUT /api/users", cfg.update_passwordEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/users/verify", cfg.verify_emailEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/users/verification", cfg.resend_verificationEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/password/forgot", cfg.forgot_passwordEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/password/reset", cfg.reset_passwordEndpoint)
+	DefaultServeMux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.delete_chirpEndpoint)
+	DefaultServeMux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.update_chirpEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.get_chirp_revisionsEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.get_threadEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/chirps/{chirpID}/like", cfg.likeEndpoint)
+	DefaultServeMux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.unlikeEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/chirps/{chirpID}/likes", cfg.get_likesEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", cfg.rechirpEndpoint)
+	DefaultServeMux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", cfg.unrechirpEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/chirps/{chirpID}/rechirps", cfg.get_rechirpsEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/chirps/{chirpID}/reports", cfg.report_chirpEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/users/{userID}", cfg.get_userEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/users/{userID}/follow", cfg.followEndpoint)
+	DefaultServeMux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.unfollowEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/users/{userID}/followers", cfg.get_followersEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/users/{userID}/following", cfg.get_followingEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/timeline", cfg.get_timelineEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/search/chirps", cfg.search_chirpsEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/tags/trending", cfg.get_trending_tagsEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/tags/{tag}/chirps", cfg.get_tag_chirpsEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/users/me/mentions", cfg.get_mentionsEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/users/me/2fa/setup", cfg.setup_two_factorEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/users/me/2fa/enable", cfg.enable_two_factorEndpoint)
+	DefaultServeMux.HandleFunc("GET /api/users/me/sessions", cfg.get_sessionsEndpoint)
+	DefaultServeMux.HandleFunc("DELETE /api/users/me/sessions/{sessionID}", cfg.delete_sessionEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/users/me/sessions/revoke-others", cfg.revoke_other_sessionsEndpoint)
+	DefaultServeMux.HandleFunc("POST /api/polka/webhooks", cfg.polkaWebhookEndpoint)
+
+	return cfg.middlewareLogging(cfg.middlewareMetrics(DefaultServeMux))
+}
+
 func main() {
 	err := run()
 	if err != nil {
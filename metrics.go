@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/metrics"
+)
+
+type serverMetrics struct {
+	registry         *metrics.Registry
+	requests         *metrics.CounterVec
+	requestDurations *metrics.HistogramVec
+	queryDurations   *metrics.HistogramVec
+}
+
+func (cfg *apiConfig) newServerMetrics() *serverMetrics {
+	registry := metrics.NewRegistry()
+
+	registry.NewCounterFunc("chirpy_fileserver_hits_total", "Requests served from /app/.", func() float64 {
+		return float64(cfg.fileserverHits.Load())
+	})
+
+	return &serverMetrics{
+		registry: registry,
+		requests: registry.NewCounterVec(
+			"chirpy_http_requests_total",
+			"HTTP requests by route pattern and status class.",
+			"route", "status",
+		),
+		requestDurations: registry.NewHistogramVec(
+			"chirpy_http_request_duration_seconds",
+			"HTTP request latency by route pattern.",
+			metrics.DefaultBuckets,
+			"route",
+		),
+		queryDurations: registry.NewHistogramVec(
+			"chirpy_db_query_duration_seconds",
+			"Database query latency by sqlc query name, up to the first row.",
+			metrics.DefaultBuckets,
+			"query",
+		),
+	}
+}
+
+// registerDBStats exposes the connection pool statistics of db.
+func (m *serverMetrics) registerDBStats(db *sql.DB) {
+	gauges := []struct {
+		name string
+		help string
+		fn   func(s sql.DBStats) float64
+	}{
+		{"chirpy_db_max_open_connections", "Maximum number of open connections to the database.", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"chirpy_db_open_connections", "Established connections, both in use and idle.", func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"chirpy_db_in_use_connections", "Connections currently in use.", func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"chirpy_db_idle_connections", "Idle connections.", func(s sql.DBStats) float64 { return float64(s.Idle) }},
+	}
+	for _, g := range gauges {
+		m.registry.NewGaugeFunc(g.name, g.help, func() float64 { return g.fn(db.Stats()) })
+	}
+
+	counters := []struct {
+		name string
+		help string
+		fn   func(s sql.DBStats) float64
+	}{
+		{"chirpy_db_wait_count_total", "Connections waited for.", func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"chirpy_db_wait_duration_seconds_total", "Time spent waiting for a connection.", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+		{"chirpy_db_max_idle_closed_total", "Connections closed due to SetMaxIdleConns.", func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+		{"chirpy_db_max_idle_time_closed_total", "Connections closed due to SetConnMaxIdleTime.", func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }},
+		{"chirpy_db_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime.", func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+	}
+	for _, c := range counters {
+		m.registry.NewCounterFunc(c.name, c.help, func() float64 { return c.fn(db.Stats()) })
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which the
+// event stream needs for flushing.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (cfg *apiConfig) middlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		// The mux fills in the matched pattern. Unmatched paths share one
+		// label so scanners can't blow up the number of series.
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		cfg.metrics.requests.Inc(route, strconv.Itoa(status/100)+"xx")
+		cfg.metrics.requestDurations.Observe(time.Since(start).Seconds(), route)
+	})
+}
+
+// instrumentedDB times every statement sent through the sqlc queries. sqlc
+// prefixes each statement with "-- name: <Query>", which names the series.
+//
+// DBTX hands back *sql.Rows and *sql.Row, which can't be wrapped, so reads
+// are timed until the driver returns the first row. Time spent scanning the
+// rest of a result set isn't included.
+type instrumentedDB struct {
+	database.DBTX
+	durations *metrics.HistogramVec
+}
+
+func (m *serverMetrics) instrumentDB(db database.DBTX) database.DBTX {
+	return &instrumentedDB{DBTX: db, durations: m.queryDurations}
+}
+
+func (db *instrumentedDB) observe(query string, start time.Time) {
+	db.durations.Observe(time.Since(start).Seconds(), queryName(query))
+}
+
+func (db *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer db.observe(query, time.Now())
+	return db.DBTX.ExecContext(ctx, query, args...)
+}
+
+func (db *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer db.observe(query, time.Now())
+	return db.DBTX.QueryContext(ctx, query, args...)
+}
+
+func (db *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer db.observe(query, time.Now())
+	return db.DBTX.QueryRowContext(ctx, query, args...)
+}
+
+func queryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "unknown"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
+
+// wantsPrometheus reports whether the client asked for the text exposition
+// format rather than the HTML page browsers get.
+func wantsPrometheus(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "text/html") {
+		return false
+	}
+	return strings.Contains(accept, "text/plain") || strings.Contains(accept, "application/openmetrics-text")
+}
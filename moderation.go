@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/moderation"
+	"github.com/google/uuid"
+)
+
+// moderationRefresh is how long a pipeline is reused before the stored
+// rules are read again. Changes made through this instance's admin API
+// apply immediately; other instances see them within this interval.
+const moderationRefresh = 30 * time.Second
+
+// moderator builds the moderation pipeline from the rules loaded at startup
+// and the rules stored in the database.
+type moderator struct {
+	static []moderation.Rule
+
+	mu       sync.Mutex
+	pipeline *moderation.Pipeline
+	loadedAt time.Time
+	// generation counts invalidations, so a load that raced with a rule
+	// change doesn't put the old rules back.
+	generation uint64
+}
+
+func newModerator(static []moderation.Rule) *moderator {
+	return &moderator{static: static}
+}
+
+func (m *moderator) invalidate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pipeline = nil
+	m.generation++
+}
+
+// moderationPipeline returns the current pipeline, reloading the stored
+// rules when it is stale. The rules are read without holding the lock, so
+// a slow database doesn't hold up chirps that could use the cached
+// pipeline.
+func (cfg *apiConfig) moderationPipeline(ctx context.Context) (*moderation.Pipeline, error) {
+	m := cfg.moderation
+	m.mu.Lock()
+	pipeline, generation := m.pipeline, m.generation
+	fresh := pipeline != nil && time.Since(m.loadedAt) < moderationRefresh
+	m.mu.Unlock()
+	if fresh {
+		return pipeline, nil
+	}
+
+	loadedAt := time.Now()
+	stored, err := cfg.queries.ListModerationRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := append([]moderation.Rule(nil), m.static...)
+	for _, s := range stored {
+		built, err := moderation.NewRules(s.Kind, moderation.Action(s.Action), []string{s.Value})
+		if err != nil {
+			// Rules are validated when they are created, so this only
+			// happens if the table was edited by hand.
+			cfg.logger.Error("skipping invalid moderation rule", "rule_id", s.ID, "err", err)
+			continue
+		}
+		rules = append(rules, built...)
+	}
+
+	pipeline = moderation.NewPipeline(rules...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.generation == generation && (m.pipeline == nil || loadedAt.After(m.loadedAt)) {
+		m.pipeline = pipeline
+		m.loadedAt = loadedAt
+	}
+	return pipeline, nil
+}
+
+// rejectionDetails describe each kind of rule without giving away the exact
+// word or pattern that matched.
+var rejectionDetails = map[string]string{
+	moderation.KindWord:        "Contains a blocked word",
+	moderation.KindRegex:       "Matches a blocked pattern",
+	moderation.KindDomain:      "Links to a blocked domain",
+	moderation.KindMaxMentions: "Mentions too many users",
+}
+
+// moderateChirp enforces the length limit and runs the moderation rules
+// over a new chirp body. On failure the error response has already been
+// sent.
+func (cfg *apiConfig) moderateChirp(w http.ResponseWriter, r *http.Request, body string) (moderation.Result, bool) {
+	if len(body) > maxChirpLength {
+		respondWithError(w, errChirpTooLong)
+		return moderation.Result{}, false
+	}
+
+	pipeline, err := cfg.moderationPipeline(r.Context())
+	if err != nil {
+		requestLogger(r).Error("loading moderation rules", "err", err)
+		respondWithError(w, errInternal)
+		return moderation.Result{}, false
+	}
+
+	result := pipeline.Moderate(body)
+	if result.Rejected() {
+		var fields []fieldError
+		seen := make(map[string]bool)
+		for _, f := range result.Findings {
+			if f.Action != moderation.Reject || seen[f.Kind] {
+				continue
+			}
+			seen[f.Kind] = true
+			fields = append(fields, fieldError{Field: "body", Code: "rejected", Detail: rejectionDetails[f.Kind]})
+		}
+		requestLogger(r).Info("chirp rejected by moderation", "rules", result.Rules(moderation.Reject))
+		respondWithError(w, errChirpRejected.withFields(fields...))
+		return moderation.Result{}, false
+	}
+
+	return result, true
+}
+
+// flagChirp queues the chirp for review when a flag rule matched. The chirp
+// is already saved, so a failure is logged rather than returned.
+func (cfg *apiConfig) flagChirp(r *http.Request, chirpID uuid.UUID, result moderation.Result) {
+	if !result.Flagged() {
+		return
+	}
+
+	err := cfg.queries.FlagChirp(r.Context(), database.FlagChirpParams{
+		ChirpID: chirpID,
+		Rules:   result.Rules(moderation.Flag),
+	})
+	if err != nil {
+		requestLogger(r).Error("flagging chirp", "chirp_id", chirpID, "err", err)
+	}
+}
+
+type ModerationRuleResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Kind      string    `json:"kind"`
+	Action    string    `json:"action"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) get_moderation_rulesEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	rules, err := cfg.queries.ListModerationRules(r.Context())
+	if err != nil {
+		requestLogger(r).Error("listing moderation rules", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	res := make([]ModerationRuleResponse, 0, len(rules))
+	for _, rule := range rules {
+		res = append(res, ModerationRuleResponse(rule))
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) create_moderation_ruleEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type payload struct {
+		Kind   string `json:"kind"`
+		Action string `json:"action"`
+		Value  string `json:"value"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var postVal payload
+	if err := decoder.Decode(&postVal); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	var fields []fieldError
+	action, err := moderation.ParseAction(postVal.Action)
+	if err != nil {
+		fields = append(fields, fieldError{Field: "action", Code: "invalid", Detail: "Action must be mask, flag or reject"})
+	}
+	if postVal.Value == "" {
+		fields = append(fields, fieldError{Field: "value", Code: "required", Detail: "Value is required"})
+	}
+	if len(fields) == 0 {
+		if _, err := moderation.NewRules(postVal.Kind, action, []string{postVal.Value}); err != nil {
+			fields = append(fields, fieldError{Field: "value", Code: "invalid", Detail: err.Error()})
+		}
+	}
+	if len(fields) > 0 {
+		respondWithError(w, errValidation.withFields(fields...))
+		return
+	}
+
+	rule, err := cfg.queries.CreateModerationRule(r.Context(), database.CreateModerationRuleParams{
+		Kind:   postVal.Kind,
+		Action: string(action),
+		Value:  postVal.Value,
+	})
+	if err != nil {
+		requestLogger(r).Error("creating moderation rule", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+	cfg.moderation.invalidate()
+
+	requestLogger(r).Info("moderation rule created", "rule_id", rule.ID, "kind", rule.Kind, "action", rule.Action)
+	respondWithJSON(w, http.StatusCreated, ModerationRuleResponse(rule))
+}
+
+func (cfg *apiConfig) delete_moderation_ruleEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	errRuleNotFound := errNotFound.withDetail("Moderation rule was not found")
+	id, err := uuid.Parse(r.PathValue("ruleID"))
+	if err != nil {
+		respondWithError(w, errRuleNotFound)
+		return
+	}
+
+	n, err := cfg.queries.DeleteModerationRule(r.Context(), id)
+	if err != nil {
+		requestLogger(r).Error("deleting moderation rule", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, errRuleNotFound)
+		return
+	}
+	cfg.moderation.invalidate()
+
+	requestLogger(r).Info("moderation rule deleted", "rule_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// pageCursor points at the last row of a page. Rows are ordered by
+// (created_at, id) so the position stays stable when new rows are inserted.
+// Search results are ordered by rank first, so their cursors carry it too.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+	Rank      float32
+}
+
+func (c pageCursor) encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	if c.Rank != 0 {
+		raw += "|" + strconv.FormatFloat(float64(c.Rank), 'g', -1, 32)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errors.New("malformed cursor")
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 2 && len(parts) != 3 {
+		return pageCursor{}, errors.New("malformed cursor")
+	}
+	createdAt, id := parts[0], parts[1]
+
+	var rank float64
+	if len(parts) == 3 {
+		rank, err = strconv.ParseFloat(parts[2], 32)
+		if err != nil {
+			return pageCursor{}, errors.New("malformed cursor rank")
+		}
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return pageCursor{}, errors.New("malformed cursor time")
+	}
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return pageCursor{}, errors.New("malformed cursor id")
+	}
+
+	return pageCursor{CreatedAt: t, ID: uid, Rank: float32(rank)}, nil
+}
+
+type pageRequest struct {
+	Limit  int32
+	Cursor *pageCursor
+}
+
+func parsePageRequest(q url.Values) (pageRequest, error) {
+	page := pageRequest{Limit: defaultPageSize}
+
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return pageRequest{}, errors.New("limit must be a positive integer")
+		}
+		page.Limit = int32(min(n, maxPageSize))
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		cursor, err := decodeCursor(c)
+		if err != nil {
+			return pageRequest{}, err
+		}
+		page.Cursor = &cursor
+	}
+
+	return page, nil
+}
+
+// cursorParams converts the cursor into the nullable arguments taken by the
+// paginated queries; a missing cursor starts from the first page.
+func (p pageRequest) cursorParams() (sql.NullTime, uuid.NullUUID) {
+	if p.Cursor == nil {
+		return sql.NullTime{}, uuid.NullUUID{}
+	}
+
+	return sql.NullTime{Time: p.Cursor.CreatedAt, Valid: true}, uuid.NullUUID{UUID: p.Cursor.ID, Valid: true}
+}
+
+// setNextLink advertises the next page in a Link header (RFC 8288) when the
+// current page came back full.
+func setNextLink(w http.ResponseWriter, r *http.Request, page pageRequest, returned int, last pageCursor) {
+	if returned < int(page.Limit) {
+		return
+	}
+
+	next := *r.URL
+	q := next.Query()
+	q.Set("cursor", last.encode())
+	q.Set("limit", strconv.Itoa(int(page.Limit)))
+	next.RawQuery = q.Encode()
+
+	w.Header().Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/mail"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+	// passwordResetTimeout bounds the lookup and mail that run after
+	// forgot_passwordEndpoint has answered.
+	passwordResetTimeout = time.Minute
+)
+
+const passwordResetBody = `Someone asked to reset the password of your Chirpy account.
+
+Your reset token is:
+
+%s
+
+Send it with your new password to POST /api/password/reset within %d minutes.
+If you didn't ask for this you can ignore this email, your password
+stays the same.
+`
+
+// forgot_passwordEndpoint mails a reset token to the address. It answers the
+// same way whether or not the address belongs to an account, so it can't be
+// used to find out who is registered.
+func (cfg *apiConfig) forgot_passwordEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type payload struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var postVal payload
+	if err := decoder.Decode(&postVal); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	if strings.TrimSpace(postVal.Email) == "" {
+		respondWithError(w, errValidation.withFields(fieldError{Field: "email", Code: "required", Detail: "Email is required"}))
+		return
+	}
+
+	// The lookup and the mail happen after answering, so a registered
+	// address doesn't take longer than an unknown one.
+	logger := requestLogger(r)
+	ctx := context.WithoutCancel(r.Context())
+	cfg.background.Go(func() {
+		ctx, cancel := context.WithTimeout(ctx, passwordResetTimeout)
+		defer cancel()
+
+		if err := cfg.sendPasswordReset(ctx, logger, postVal.Email); err != nil {
+			logger.Error("sending password reset", "err", err)
+		}
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, logger *slog.Logger, email string) error {
+	user, err := cfg.queries.GetUserWithEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Info("password reset for unknown email")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.queries.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		TokenHash:  auth.HashToken(token),
+		UserID:     user.ID,
+		TtlSeconds: passwordResetTTL.Seconds(),
+	})
+	if err != nil {
+		return fmt.Errorf("storing reset token: %w", err)
+	}
+
+	err = cfg.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body:    fmt.Sprintf(passwordResetBody, token, int(passwordResetTTL.Minutes())),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("password reset sent", "user_id", user.ID)
+	return nil
+}
+
+// reset_passwordEndpoint sets a new password with a token from
+// forgot_passwordEndpoint. Every session of the user is revoked, since the
+// reset may be locking out someone who took over the account.
+func (cfg *apiConfig) reset_passwordEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var postVal payload
+	if err := decoder.Decode(&postVal); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	var fields []fieldError
+	if postVal.Token == "" {
+		fields = append(fields, fieldError{Field: "token", Code: "required", Detail: "Token is required"})
+	}
+	if postVal.Password == "" {
+		fields = append(fields, fieldError{Field: "password", Code: "required", Detail: "Password is required"})
+	}
+	if len(fields) > 0 {
+		respondWithError(w, errValidation.withFields(fields...))
+		return
+	}
+
+	// Hash first so a password argon2id refuses doesn't use up the token.
+	hashed_password, err := auth.HashPassword(postVal.Password)
+	if err != nil {
+		requestLogger(r).Info("hashing password", "err", err)
+		respondWithError(w, errValidation.withFields(fieldError{Field: "password", Code: "invalid", Detail: err.Error()}))
+		return
+	}
+
+	user_id, err := cfg.queries.ConsumePasswordReset(r.Context(), auth.HashToken(postVal.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		requestLogger(r).Info("reset token is invalid, expired or used")
+		respondWithError(w, errResetTokenInvalid)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("consuming reset token", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	setRequestUser(r, user_id)
+
+	err = cfg.queries.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             user_id,
+		HashedPassword: hashed_password,
+	})
+	if err != nil {
+		requestLogger(r).Error("updating password", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	// Any other reset links the user asked for are no longer needed.
+	if err := cfg.queries.DeletePasswordResets(r.Context(), user_id); err != nil {
+		requestLogger(r).Error("deleting reset tokens", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	if err := cfg.queries.RevokeUserTokens(r.Context(), user_id); err != nil {
+		requestLogger(r).Error("revoking refresh tokens", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	requestLogger(r).Info("password reset")
+	w.WriteHeader(http.StatusNoContent)
+}
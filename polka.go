@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// polkaWebhookEndpoint applies membership changes sent by Polka, our payment
+// provider. Polka retries deliveries, so every event must be safe to apply
+// more than once.
+func (cfg *apiConfig) polkaWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		requestLogger(r).Info("getting api key from header", "err", err)
+		respondWithError(w, errAPIKeyInvalid)
+		return
+	}
+
+	if cfg.polkaKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.polkaKey)) != 1 {
+		requestLogger(r).Info("polka api key doesn't match")
+		respondWithError(w, errAPIKeyInvalid)
+		return
+	}
+
+	type payload struct {
+		Event string `json:"event"`
+		Data  struct {
+			UserID uuid.UUID `json:"user_id"`
+		} `json:"data"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var event payload
+	if err := decoder.Decode(&event); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	var isChirpyRed bool
+	switch event.Event {
+	case "user.upgraded":
+		isChirpyRed = true
+	case "user.downgraded":
+		isChirpyRed = false
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	updated, err := cfg.queries.SetUserChirpyRed(r.Context(), database.SetUserChirpyRedParams{
+		ID:          event.Data.UserID,
+		IsChirpyRed: isChirpyRed,
+	})
+	if err != nil {
+		requestLogger(r).Error("updating chirpy red membership", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	if updated == 0 {
+		respondWithError(w, errUserNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
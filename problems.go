@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+const problemContentType = "application/problem+json"
+
+// apiError is an error response. Code is part of the API: clients branch on
+// it, so existing codes must not change meaning.
+type apiError struct {
+	Status int
+	Code   string
+	Detail string
+	Errors []fieldError
+}
+
+// fieldError points at a single invalid field of the request body.
+type fieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+func (e apiError) Error() string {
+	return e.Code + ": " + e.Detail
+}
+
+func (e apiError) withDetail(detail string) apiError {
+	e.Detail = detail
+	return e
+}
+
+func (e apiError) withFields(fields ...fieldError) apiError {
+	e.Errors = append(slices.Clone(e.Errors), fields...)
+	return e
+}
+
+var (
+	errInternal = apiError{Status: http.StatusInternalServerError, Code: "internal_error", Detail: "Something went wrong"}
+
+	errInvalidJSON     = apiError{Status: http.StatusBadRequest, Code: "invalid_json", Detail: "Request body must be valid JSON"}
+	errInvalidQuery    = apiError{Status: http.StatusBadRequest, Code: "invalid_query", Detail: "Invalid query parameters"}
+	errValidation      = apiError{Status: http.StatusBadRequest, Code: "validation_failed", Detail: "Request body has invalid fields"}
+	errFollowSelf      = apiError{Status: http.StatusBadRequest, Code: "cannot_follow_self", Detail: "Users can't follow themselves"}
+	errAlreadyReported = apiError{Status: http.StatusConflict, Code: "already_reported", Detail: "You already reported this chirp"}
+	errEmailTaken      = apiError{Status: http.StatusConflict, Code: "email_taken", Detail: "Email is already registered"}
+	errHandleTaken     = apiError{Status: http.StatusConflict, Code: "handle_taken", Detail: "Handle is already taken"}
+	errConflict        = apiError{Status: http.StatusConflict, Code: "conflict", Detail: "Resource already exists"}
+	errNotFound        = apiError{Status: http.StatusNotFound, Code: "not_found", Detail: "Resource was not found"}
+	errChirpNotFound   = apiError{Status: http.StatusNotFound, Code: "chirp_not_found", Detail: "Chirp was not found"}
+	errUserNotFound    = apiError{Status: http.StatusNotFound, Code: "user_not_found", Detail: "User was not found"}
+	errSessionNotFound = apiError{Status: http.StatusNotFound, Code: "session_not_found", Detail: "Session was not found"}
+
+	errInvalidCredentials = apiError{Status: http.StatusUnauthorized, Code: "invalid_credentials", Detail: "Incorrect email or password"}
+	errTokenMissing       = apiError{Status: http.StatusUnauthorized, Code: "token_missing", Detail: "Authorization header is missing or malformed"}
+	errTokenInvalid       = apiError{Status: http.StatusUnauthorized, Code: "token_invalid", Detail: "Token is invalid"}
+	errTokenExpired       = apiError{Status: http.StatusUnauthorized, Code: "token_expired", Detail: "Token has expired"}
+	errTokenRevoked       = apiError{Status: http.StatusUnauthorized, Code: "token_revoked", Detail: "Token has been revoked"}
+	errTwoFactorInvalid   = apiError{Status: http.StatusUnauthorized, Code: "two_factor_invalid", Detail: "Incorrect or already used code"}
+	errAPIKeyInvalid      = apiError{Status: http.StatusUnauthorized, Code: "api_key_invalid", Detail: "Incorrect or non existent api key"}
+
+	errResetTokenInvalid        = apiError{Status: http.StatusBadRequest, Code: "reset_token_invalid", Detail: "Reset token is invalid, expired or already used"}
+	errVerificationTokenInvalid = apiError{Status: http.StatusBadRequest, Code: "verification_token_invalid", Detail: "Verification link is invalid, expired or already used"}
+	errTwoFactorEnabled         = apiError{Status: http.StatusConflict, Code: "two_factor_enabled", Detail: "Two-factor authentication is already enabled"}
+	errTwoFactorNotSetUp        = apiError{Status: http.StatusConflict, Code: "two_factor_not_set_up", Detail: "Set up two-factor authentication first"}
+	errEmailAlreadyVerified     = apiError{Status: http.StatusConflict, Code: "email_already_verified", Detail: "Email is already verified"}
+
+	errNotOwner  = apiError{Status: http.StatusForbidden, Code: "not_owner", Detail: "Only the author can do this"}
+	errForbidden = apiError{Status: http.StatusForbidden, Code: "forbidden", Detail: "Not allowed on this platform"}
+
+	errInsufficientRole = apiError{Status: http.StatusForbidden, Code: "insufficient_role", Detail: "Your role doesn't allow this"}
+	errEmailNotVerified = apiError{Status: http.StatusForbidden, Code: "email_not_verified", Detail: "Verify your email address first"}
+	errAccountSuspended = apiError{Status: http.StatusForbidden, Code: "account_suspended", Detail: "Account is suspended"}
+
+	errTooManyLogins = apiError{Status: http.StatusTooManyRequests, Code: "too_many_logins", Detail: "Too many failed logins, try again later"}
+)
+
+var errChirpTooLong = apiError{
+	Status: http.StatusBadRequest,
+	Code:   "chirp_too_long",
+	Detail: "Chirp is too long",
+	Errors: []fieldError{
+		{Field: "body", Code: "too_long", Detail: "Chirps are limited to 140 characters"},
+	},
+}
+
+// errChirpRejected carries a field error for each kind of moderation rule
+// the body broke.
+var errChirpRejected = apiError{Status: http.StatusBadRequest, Code: "chirp_rejected", Detail: "Chirp was rejected by moderation"}
+
+// databaseError maps errors from the queries to the response the client
+// should see. Anything unrecognised is an internal error.
+func databaseError(err error) apiError {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return errInternal
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		switch pqErr.Constraint {
+		case "users_email_key":
+			return errEmailTaken
+		case "users_handle_key":
+			return errHandleTaken
+		case "chirp_reports_open_key":
+			return errAlreadyReported
+		case "moderation_rules_kind_value_key":
+			return errConflict.withDetail("A rule with this kind and value already exists")
+		}
+		return errConflict
+	case "foreign_key_violation":
+		switch pqErr.Constraint {
+		case "chirps_in_reply_to_fkey", "likes_chirp_id_fkey", "rechirps_chirp_id_fkey", "chirp_reports_chirp_id_fkey":
+			return errChirpNotFound
+		}
+		// The remaining foreign keys point at users.
+		return errUserNotFound
+	case "check_violation":
+		if pqErr.Constraint == "follows_check" {
+			return errFollowSelf
+		}
+		return errValidation
+	}
+
+	return errInternal
+}
+
+// problemDetails is the RFC 9457 body. Code and RequestID are extension
+// members.
+type problemDetails struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+func respondWithError(w http.ResponseWriter, apiErr apiError) {
+	body, err := json.Marshal(problemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(apiErr.Status),
+		Status: apiErr.Status,
+		Detail: apiErr.Detail,
+		Code:   apiErr.Code,
+		// middlewareLogging sets the header before any handler runs.
+		RequestID: w.Header().Get(requestIDHeader),
+		Errors:    apiErr.Errors,
+	})
+	if err != nil {
+		slog.Error("json marshal failed", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(apiErr.Status)
+	w.Write(body)
+}
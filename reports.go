@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/events"
+	"github.com/google/uuid"
+)
+
+const maxReportCommentLength = 500
+
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "misinformation", "other"}
+
+// Resolutions a moderator can apply to a queued chirp. Every one of them
+// closes the chirp's open reports and clears its moderation flags.
+const (
+	resolveDismiss = "dismiss"
+	resolveHide    = "hide"
+	resolveDelete  = "delete"
+	resolveSuspend = "suspend"
+)
+
+type ReportResponse struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Reason    string    `json:"reason"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QueueItemResponse is a chirp waiting for review with what put it there.
+type QueueItemResponse struct {
+	ChirpResponse
+	QueuedAt    time.Time `json:"queued_at"`
+	ReportCount int64     `json:"report_count"`
+	Reasons     []string  `json:"reasons"`
+	Rules       []string  `json:"rules"`
+}
+
+func (cfg *apiConfig) report_chirpEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.canInteract(w, r, user_id) {
+		return
+	}
+
+	chirp, ok := cfg.pathChirp(w, r)
+	if !ok {
+		return
+	}
+
+	type payload struct {
+		Reason  string `json:"reason"`
+		Comment string `json:"comment"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var postVal payload
+	if err := decoder.Decode(&postVal); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	var fields []fieldError
+	if !slices.Contains(reportReasons, postVal.Reason) {
+		fields = append(fields, fieldError{Field: "reason", Code: "invalid", Detail: "Reason must be one of " + strings.Join(reportReasons, ", ")})
+	}
+	if len(postVal.Comment) > maxReportCommentLength {
+		fields = append(fields, fieldError{Field: "comment", Code: "too_long", Detail: "Comments are limited to 500 characters"})
+	}
+	if len(fields) > 0 {
+		respondWithError(w, errValidation.withFields(fields...))
+		return
+	}
+
+	report, err := cfg.queries.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:    chirp.ID,
+		ReporterID: user_id,
+		Reason:     postVal.Reason,
+		Comment:    postVal.Comment,
+	})
+	if err != nil {
+		requestLogger(r).Info("creating report", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	requestLogger(r).Info("chirp reported", "chirp_id", chirp.ID, "reason", report.Reason)
+	respondWithJSON(w, http.StatusCreated, ReportResponse{
+		ID:        report.ID,
+		ChirpID:   report.ChirpID,
+		Reason:    report.Reason,
+		Comment:   report.Comment,
+		CreatedAt: report.CreatedAt,
+	})
+}
+
+// get_moderation_queueEndpoint lists reported and flagged chirps, oldest
+// first, so moderators work through them in the order they came in.
+func (cfg *apiConfig) get_moderation_queueEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	rows, err := cfg.queries.ListModerationQueue(r.Context(), database.ListModerationQueueParams{
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("listing moderation queue", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	res := make([]QueueItemResponse, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, QueueItemResponse{
+			ChirpResponse: chirpToResponse(database.Chirp{
+				ID:            row.ID,
+				Body:          row.Body,
+				UserID:        row.UserID,
+				CreatedAt:     row.CreatedAt,
+				UpdatedAt:     row.UpdatedAt,
+				RevisionCount: row.RevisionCount,
+				InReplyTo:     row.InReplyTo,
+				ReplyCount:    row.ReplyCount,
+				DeletedAt:     row.DeletedAt,
+				LikeCount:     row.LikeCount,
+				RechirpCount:  row.RechirpCount,
+				HiddenAt:      row.HiddenAt,
+			}),
+			QueuedAt:    row.QueuedAt,
+			ReportCount: row.ReportCount,
+			Reasons:     row.Reasons,
+			Rules:       row.Rules,
+		})
+	}
+
+	if len(rows) > 0 {
+		last := rows[len(rows)-1]
+		setNextLink(w, r, page, len(rows), pageCursor{CreatedAt: last.QueuedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// resolve_moderationEndpoint takes a chirp off the moderation queue. The
+// queue item's id is the chirp's id.
+func (cfg *apiConfig) resolve_moderationEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	errNotQueued := errNotFound.withDetail("Chirp is not in the moderation queue")
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, errNotQueued)
+		return
+	}
+
+	type payload struct {
+		Action string `json:"action"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var postVal payload
+	if err := decoder.Decode(&postVal); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	switch postVal.Action {
+	case resolveDismiss, resolveHide, resolveDelete, resolveSuspend:
+	default:
+		respondWithError(w, errValidation.withFields(fieldError{Field: "action", Code: "invalid", Detail: "Action must be dismiss, hide, delete or suspend"}))
+		return
+	}
+
+	chirp, err := cfg.queries.GetChirp(r.Context(), id)
+	if err != nil || chirp.DeletedAt.Valid {
+		requestLogger(r).Info("getting chirp", "err", err)
+		respondWithError(w, errNotQueued)
+		return
+	}
+
+	queued, err := cfg.queries.IsChirpQueued(r.Context(), chirp.ID)
+	if err != nil {
+		requestLogger(r).Error("checking moderation queue", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	if !queued {
+		respondWithError(w, errNotQueued)
+		return
+	}
+
+	// The action runs before the reports are resolved, so a failed action
+	// leaves the chirp in the queue to be tried again.
+	switch postVal.Action {
+	case resolveHide:
+		_, err = cfg.queries.HideChirp(r.Context(), chirp.ID)
+		if err == nil {
+			cfg.publishChirpEvent(events.ChirpHidden, chirp.UserID, chirpDeletedEvent{
+				ID:     chirp.ID,
+				UserID: chirp.UserID,
+			})
+		}
+	case resolveDelete:
+		err = cfg.queries.DeleteChirp(r.Context(), chirp.ID)
+		if err == nil {
+			cfg.publishChirpEvent(events.ChirpDeleted, chirp.UserID, chirpDeletedEvent{
+				ID:     chirp.ID,
+				UserID: chirp.UserID,
+			})
+		}
+	case resolveSuspend:
+		_, err = cfg.queries.SuspendUser(r.Context(), chirp.UserID)
+		if err == nil {
+			err = cfg.queries.RevokeUserTokens(r.Context(), chirp.UserID)
+		}
+	}
+	if err != nil {
+		requestLogger(r).Error("applying moderation action", "action", postVal.Action, "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	reports, err := cfg.queries.ResolveChirpReports(r.Context(), database.ResolveChirpReportsParams{
+		Resolution: postVal.Action,
+		ChirpID:    chirp.ID,
+	})
+	if err != nil {
+		requestLogger(r).Error("resolving reports", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	flags, err := cfg.queries.ClearChirpFlags(r.Context(), chirp.ID)
+	if err != nil {
+		requestLogger(r).Error("clearing chirp flags", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	requestLogger(r).Info("moderation resolved", "chirp_id", chirp.ID, "action", postVal.Action, "reports", reports, "flags", flags)
+	w.WriteHeader(http.StatusNoContent)
+}
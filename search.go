@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/search"
+)
+
+// SearchResultResponse is a chirp that matched a search. Snippet is the
+// body as HTML with the matched words wrapped in <mark>.
+type SearchResultResponse struct {
+	ChirpResponse
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+func (cfg *apiConfig) search_chirpsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	viewer, ok := cfg.viewer(w, r)
+	if !ok {
+		return
+	}
+
+	query, err := search.Parse(r.URL.Query().Get("q"))
+	if errors.Is(err, search.ErrEmptyQuery) {
+		respondWithError(w, errInvalidQuery.withDetail("q is required"))
+		return
+	}
+	if err != nil {
+		requestLogger(r).Info("parsing search query", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	params := database.SearchChirpsParams{
+		Query:    query.Text(),
+		PageSize: page.Limit,
+	}
+	if query.From != "" {
+		params.FromHandle = sql.NullString{String: query.From, Valid: true}
+	}
+	if !query.Since.IsZero() {
+		params.Since = sql.NullTime{Time: query.Since, Valid: true}
+	}
+	if !query.Until.IsZero() {
+		params.Until = sql.NullTime{Time: query.Until, Valid: true}
+	}
+	params.CursorCreatedAt, params.CursorID = page.cursorParams()
+	if page.Cursor != nil {
+		params.CursorRank = sql.NullFloat64{Float64: float64(page.Cursor.Rank), Valid: true}
+	}
+
+	rows, err := cfg.queries.SearchChirps(r.Context(), params)
+	if err != nil {
+		requestLogger(r).Error("searching chirps", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	results := make([]SearchResultResponse, 0, len(rows))
+	refs := make([]*ChirpResponse, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, SearchResultResponse{
+			ChirpResponse: chirpToResponse(database.Chirp{
+				ID:            row.ID,
+				Body:          row.Body,
+				UserID:        row.UserID,
+				CreatedAt:     row.CreatedAt,
+				UpdatedAt:     row.UpdatedAt,
+				RevisionCount: row.RevisionCount,
+				InReplyTo:     row.InReplyTo,
+				ReplyCount:    row.ReplyCount,
+				DeletedAt:     row.DeletedAt,
+				LikeCount:     row.LikeCount,
+				RechirpCount:  row.RechirpCount,
+			}),
+			Rank:    row.Rank,
+			Snippet: row.Snippet,
+		})
+	}
+	for i := range results {
+		refs = append(refs, &results[i].ChirpResponse)
+	}
+	if err := cfg.setViewerState(r.Context(), viewer, refs...); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	if len(results) > 0 {
+		last := results[len(results)-1]
+		setNextLink(w, r, page, len(results), pageCursor{CreatedAt: last.CreatedAt, ID: last.ID, Rank: last.Rank})
+	}
+
+	respondWithJSON(w, http.StatusOK, results)
+}
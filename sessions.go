@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDeviceNameLength = 64
+	maxUserAgentLength  = 512
+)
+
+// SessionResponse is a signed in device. Its ID is the refresh token family,
+// which stays the same across refreshes.
+type SessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceName string    `json:"device_name,omitempty"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// clientIP is the address the request came from. X-Forwarded-For is not
+// trusted since chirpy doesn't know which proxies sit in front of it.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func validateDeviceName(name string) (string, []fieldError) {
+	name = strings.TrimSpace(name)
+	if len(name) > maxDeviceNameLength {
+		return "", []fieldError{{Field: "device_name", Code: "too_long", Detail: "Device names are at most 64 characters"}}
+	}
+	return name, nil
+}
+
+// createRefreshToken stores a new refresh token in the family along with the
+// client that asked for it.
+func (cfg *apiConfig) createRefreshToken(r *http.Request, userID, familyID uuid.UUID, deviceName string) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	_, err = cfg.queries.CreateToken(r.Context(), database.CreateTokenParams{
+		Token:      token,
+		UserID:     userID,
+		ExpiresAt:  time.Now().Add(refreshTokenTTL),
+		FamilyID:   familyID,
+		UserAgent:  userAgent,
+		Ip:         clientIP(r),
+		DeviceName: deviceName,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (cfg *apiConfig) get_sessionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	claims, ok := cfg.accessClaims(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := cfg.queries.ListSessions(r.Context(), claims.UserID)
+	if err != nil {
+		requestLogger(r).Error("listing sessions", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	res := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, SessionResponse{
+			ID:         s.FamilyID,
+			DeviceName: s.DeviceName,
+			UserAgent:  s.UserAgent,
+			IP:         s.Ip,
+			SignedInAt: s.SignedInAt,
+			LastUsedAt: s.LastUsedAt,
+			Current:    s.FamilyID == claims.SessionID,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// delete_sessionEndpoint signs a device out. Its access token keeps working
+// until it expires, but it can't be refreshed anymore.
+func (cfg *apiConfig) delete_sessionEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		requestLogger(r).Info("transforming uuid", "err", err)
+		respondWithError(w, errSessionNotFound)
+		return
+	}
+
+	revoked, err := cfg.queries.RevokeSession(r.Context(), database.RevokeSessionParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		requestLogger(r).Error("revoking session", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	if revoked == 0 {
+		requestLogger(r).Info("session not found", "session_id", sessionID)
+		respondWithError(w, errSessionNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) revoke_other_sessionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	claims, ok := cfg.accessClaims(w, r)
+	if !ok {
+		return
+	}
+
+	// Tokens from before sessions were tracked can't tell which session is
+	// the caller's.
+	if claims.SessionID == uuid.Nil {
+		requestLogger(r).Info("access token has no session")
+		respondWithError(w, errTokenInvalid.withDetail("Token has no session, log in again"))
+		return
+	}
+
+	_, err := cfg.queries.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{
+		UserID:   claims.UserID,
+		FamilyID: claims.SessionID,
+	})
+	if err != nil {
+		requestLogger(r).Error("revoking other sessions", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,8 +1,23 @@
 -- name: CreateChirp :one
+WITH parent AS (
+    UPDATE
+        chirps
+    SET
+        reply_count = reply_count + 1
+    WHERE
+        id = sqlc.narg('in_reply_to')
+)
 INSERT INTO
-    chirps (id, body, user_id, created_at, updated_at)
+    chirps (id, body, user_id, created_at, updated_at, in_reply_to)
 VALUES
-    (gen_random_uuid(), $1, $2, NOW(), NOW())
+    (
+        gen_random_uuid(),
+        sqlc.arg('body'),
+        sqlc.arg('user_id'),
+        NOW(),
+        NOW(),
+        sqlc.narg('in_reply_to')
+    )
 RETURNING
     *;
 
@@ -10,13 +25,65 @@ RETURNING
 DELETE FROM
     chirps;
 
--- name: GetAllChirps :many
+-- name: ListChirpsAsc :many
+-- Hidden chirps are only listed for their author and for moderators.
 SELECT
     *
 FROM
     chirps
+WHERE
+    (
+        sqlc.narg('author_id')::uuid IS NULL
+        OR user_id = sqlc.narg('author_id')
+    )
+    AND deleted_at IS NULL
+    AND (
+        hidden_at IS NULL
+        OR user_id = sqlc.narg('viewer_id')
+        OR sqlc.arg('include_hidden')::bool
+    )
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (created_at, id) > (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
 ORDER BY
-    created_at;
+    created_at ASC,
+    id ASC
+LIMIT
+    sqlc.arg('page_size');
+
+-- name: ListChirpsDesc :many
+-- Hidden chirps are only listed for their author and for moderators.
+SELECT
+    *
+FROM
+    chirps
+WHERE
+    (
+        sqlc.narg('author_id')::uuid IS NULL
+        OR user_id = sqlc.narg('author_id')
+    )
+    AND deleted_at IS NULL
+    AND (
+        hidden_at IS NULL
+        OR user_id = sqlc.narg('viewer_id')
+        OR sqlc.arg('include_hidden')::bool
+    )
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (created_at, id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY
+    created_at DESC,
+    id DESC
+LIMIT
+    sqlc.arg('page_size');
 
 -- name: GetChirp :one
 SELECT
@@ -27,7 +94,185 @@ WHERE
     id = $1;
 
 -- name: DeleteChirp :exec
-DELETE FROM
+-- A chirp with replies is blanked into a placeholder instead, so its thread
+-- stays connected. Deleting a chirp outright takes it off its parent's
+-- reply count.
+WITH tombstoned AS (
+    UPDATE
+        chirps
+    SET
+        body = '',
+        revision_count = 0,
+        updated_at = NOW(),
+        deleted_at = NOW()
+    WHERE
+        id = $1
+        AND reply_count > 0
+    RETURNING
+        id
+),
+purged AS (
+    DELETE FROM
+        chirp_revisions
+    WHERE
+        chirp_id IN (
+            SELECT
+                id
+            FROM
+                tombstoned
+        )
+),
+deleted AS (
+    DELETE FROM
+        chirps
+    WHERE
+        id = $1
+        AND reply_count = 0
+    RETURNING
+        in_reply_to
+)
+UPDATE
     chirps
+SET
+    reply_count = reply_count - 1
 WHERE
-    id = $1;
+    id = (
+        SELECT
+            in_reply_to
+        FROM
+            deleted
+    );
+
+-- name: UpdateChirp :one
+-- Locking the row first makes concurrent edits queue up, so every replaced
+-- body ends up in chirp_revisions.
+WITH previous AS (
+    SELECT
+        id,
+        body,
+        updated_at
+    FROM
+        chirps
+    WHERE
+        id = $1
+        AND deleted_at IS NULL
+    FOR UPDATE
+),
+revision AS (
+    INSERT INTO
+        chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT
+        gen_random_uuid(),
+        previous.id,
+        previous.body,
+        previous.updated_at,
+        NOW()
+    FROM
+        previous
+)
+UPDATE
+    chirps
+SET
+    body = $2,
+    updated_at = NOW(),
+    revision_count = chirps.revision_count + 1
+FROM
+    previous
+WHERE
+    chirps.id = previous.id
+RETURNING
+    chirps.*;
+
+-- name: ListChirpRevisions :many
+SELECT
+    *
+FROM
+    chirp_revisions
+WHERE
+    chirp_id = $1
+ORDER BY
+    replaced_at ASC,
+    id ASC;
+
+-- name: ListChirpAncestors :many
+-- Returns the chain of parents of a chirp, starting at the thread root.
+WITH RECURSIVE ancestors AS (
+    SELECT
+        parent.*,
+        1 AS depth
+    FROM
+        chirps child
+        JOIN chirps parent ON parent.id = child.in_reply_to
+    WHERE
+        child.id = $1
+    UNION ALL
+    SELECT
+        chirps.*,
+        ancestors.depth + 1
+    FROM
+        chirps
+        JOIN ancestors ON chirps.id = ancestors.in_reply_to
+)
+SELECT
+    id,
+    body,
+    user_id,
+    created_at,
+    updated_at,
+    revision_count,
+    in_reply_to,
+    reply_count,
+    deleted_at,
+    like_count,
+    rechirp_count,
+    search,
+    hidden_at
+FROM
+    ancestors
+ORDER BY
+    depth DESC;
+
+-- name: ListChirpReplies :many
+-- Returns every reply below a chirp in (created_at, id) order. Parents are
+-- always older than their replies, so each page can be stitched onto the
+-- tree built from the previous ones.
+WITH RECURSIVE replies AS (
+    SELECT
+        chirps.*,
+        1 AS depth
+    FROM
+        chirps
+    WHERE
+        in_reply_to = sqlc.arg('chirp_id')
+    UNION ALL
+    SELECT
+        chirps.*,
+        replies.depth + 1
+    FROM
+        chirps
+        JOIN replies ON chirps.in_reply_to = replies.id
+)
+SELECT
+    *
+FROM
+    replies
+WHERE
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (
+        sqlc.narg('cursor_created_at')::timestamp,
+        sqlc.narg('cursor_id')::uuid
+    )
+ORDER BY
+    created_at ASC,
+    id ASC
+LIMIT
+    sqlc.arg('page_size');
+
+-- name: HideChirp :execrows
+UPDATE
+    chirps
+SET
+    hidden_at = COALESCE(hidden_at, NOW())
+WHERE
+    id = $1
+    AND deleted_at IS NULL;
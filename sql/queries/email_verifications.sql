@@ -0,0 +1,18 @@
+-- name: CreateEmailVerification :exec
+INSERT INTO
+    email_verifications(token_hash, user_id, email, created_at, expires_at)
+VALUES
+    ($1, $2, $3, NOW(), NOW() + make_interval(secs => sqlc.arg('ttl_seconds')::float8));
+
+-- name: ConsumeEmailVerification :one
+UPDATE
+    email_verifications
+SET
+    used_at = NOW()
+WHERE
+    token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING
+    user_id,
+    email;
@@ -0,0 +1,104 @@
+-- name: FollowUser :exec
+INSERT INTO
+    follows (follower_id, followee_id, created_at)
+VALUES
+    ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM
+    follows
+WHERE
+    follower_id = $1
+    AND followee_id = $2;
+
+-- name: CountFollowers :one
+SELECT
+    COUNT(*)
+FROM
+    follows
+WHERE
+    followee_id = $1;
+
+-- name: CountFollowing :one
+SELECT
+    COUNT(*)
+FROM
+    follows
+WHERE
+    follower_id = $1;
+
+-- name: ListFollowers :many
+SELECT
+    users.id,
+    users.handle,
+    follows.created_at AS followed_at
+FROM
+    follows
+    JOIN users ON follows.follower_id = users.id
+WHERE
+    follows.followee_id = sqlc.arg('user_id')
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (follows.created_at, users.id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY
+    follows.created_at DESC,
+    users.id DESC
+LIMIT
+    sqlc.arg('page_size');
+
+-- name: ListFollowing :many
+SELECT
+    users.id,
+    users.handle,
+    follows.created_at AS followed_at
+FROM
+    follows
+    JOIN users ON follows.followee_id = users.id
+WHERE
+    follows.follower_id = sqlc.arg('user_id')
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (follows.created_at, users.id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY
+    follows.created_at DESC,
+    users.id DESC
+LIMIT
+    sqlc.arg('page_size');
+
+-- name: GetTimeline :many
+SELECT
+    *
+FROM
+    chirps
+WHERE
+    user_id IN (
+        SELECT
+            followee_id
+        FROM
+            follows
+        WHERE
+            follower_id = sqlc.arg('follower_id')
+    )
+    AND deleted_at IS NULL
+    AND hidden_at IS NULL
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (created_at, id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY
+    created_at DESC,
+    id DESC
+LIMIT
+    sqlc.arg('page_size');
@@ -0,0 +1,78 @@
+-- name: LikeChirp :execrows
+-- The counter only moves when a row is actually inserted, so retries and
+-- concurrent requests can't count the same user twice.
+WITH inserted AS (
+    INSERT INTO
+        likes (user_id, chirp_id, created_at)
+    VALUES
+        ($1, $2, NOW())
+    ON CONFLICT DO NOTHING
+    RETURNING
+        chirp_id
+)
+UPDATE
+    chirps
+SET
+    like_count = like_count + 1
+WHERE
+    id IN (
+        SELECT
+            chirp_id
+        FROM
+            inserted
+    );
+
+-- name: UnlikeChirp :execrows
+WITH deleted AS (
+    DELETE FROM
+        likes
+    WHERE
+        user_id = $1
+        AND chirp_id = $2
+    RETURNING
+        chirp_id
+)
+UPDATE
+    chirps
+SET
+    like_count = like_count - 1
+WHERE
+    id IN (
+        SELECT
+            chirp_id
+        FROM
+            deleted
+    );
+
+-- name: ListChirpLikes :many
+SELECT
+    users.id,
+    users.handle,
+    likes.created_at AS liked_at
+FROM
+    likes
+    JOIN users ON likes.user_id = users.id
+WHERE
+    likes.chirp_id = sqlc.arg('chirp_id')
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (likes.created_at, users.id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY
+    likes.created_at DESC,
+    users.id DESC
+LIMIT
+    sqlc.arg('page_size');
+
+-- name: ListLikedChirpIDs :many
+-- Returns which of the given chirps the user has liked.
+SELECT
+    chirp_id
+FROM
+    likes
+WHERE
+    user_id = sqlc.arg('user_id')
+    AND chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
@@ -0,0 +1,39 @@
+-- name: GetLoginLockout :one
+-- The seconds left on the key's lockout, if it has one that hasn't run out.
+SELECT
+    EXTRACT(EPOCH FROM locked_until - NOW())::float8 AS retry_after
+FROM
+    login_throttles
+WHERE
+    key = $1
+    AND locked_until > NOW();
+
+-- name: RecordLoginFailure :one
+-- Failures from before the window are forgotten and the count starts over.
+INSERT INTO
+    login_throttles(key, failures, updated_at)
+VALUES
+    (sqlc.arg('key'), 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET
+    failures = CASE
+        WHEN login_throttles.updated_at < NOW() - make_interval(secs => sqlc.arg('window_seconds')::float8) THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    updated_at = NOW()
+RETURNING
+    failures;
+
+-- name: LockLogin :exec
+UPDATE
+    login_throttles
+SET
+    locked_until = NOW() + make_interval(secs => sqlc.arg('lockout_seconds')::float8)
+WHERE
+    key = sqlc.arg('key');
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM
+    login_throttles
+WHERE
+    key = $1;
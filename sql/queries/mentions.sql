@@ -0,0 +1,55 @@
+-- name: SetChirpMentions :exec
+-- Replaces the users a chirp mentions. Handles that don't belong to anyone
+-- are ignored.
+WITH mentioned AS (
+    SELECT
+        id
+    FROM
+        users
+    WHERE
+        handle = ANY(sqlc.arg('handles')::text[])
+),
+removed AS (
+    DELETE FROM
+        chirp_mentions
+    WHERE
+        chirp_id = sqlc.arg('chirp_id')
+        AND user_id NOT IN (
+            SELECT
+                id
+            FROM
+                mentioned
+        )
+)
+INSERT INTO
+    chirp_mentions (chirp_id, user_id, created_at)
+SELECT
+    sqlc.arg('chirp_id'),
+    id,
+    NOW()
+FROM
+    mentioned
+ON CONFLICT DO NOTHING;
+
+-- name: ListMentions :many
+SELECT
+    chirps.*
+FROM
+    chirps
+    JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE
+    chirp_mentions.user_id = sqlc.arg('user_id')
+    AND chirps.deleted_at IS NULL
+    AND chirps.hidden_at IS NULL
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (chirps.created_at, chirps.id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY
+    chirps.created_at DESC,
+    chirps.id DESC
+LIMIT
+    sqlc.arg('page_size');
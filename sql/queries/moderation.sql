@@ -0,0 +1,44 @@
+-- name: CreateModerationRule :one
+INSERT INTO
+    moderation_rules (id, kind, action, value, created_at)
+VALUES
+    (
+        gen_random_uuid(),
+        sqlc.arg('kind'),
+        sqlc.arg('action'),
+        sqlc.arg('value'),
+        NOW()
+    )
+RETURNING
+    *;
+
+-- name: ListModerationRules :many
+SELECT
+    *
+FROM
+    moderation_rules
+ORDER BY
+    created_at,
+    id;
+
+-- name: DeleteModerationRule :execrows
+DELETE FROM
+    moderation_rules
+WHERE
+    id = sqlc.arg('id');
+
+-- name: FlagChirp :exec
+-- Rules that already flagged the chirp keep their original created_at.
+INSERT INTO
+    chirp_flags (chirp_id, rule, created_at)
+SELECT
+    sqlc.arg('chirp_id'),
+    unnest(sqlc.arg('rules')::text[]),
+    NOW()
+ON CONFLICT DO NOTHING;
+
+-- name: ClearChirpFlags :execrows
+DELETE FROM
+    chirp_flags
+WHERE
+    chirp_id = sqlc.arg('chirp_id');
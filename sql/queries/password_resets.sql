@@ -0,0 +1,25 @@
+-- name: CreatePasswordReset :exec
+INSERT INTO
+    password_resets(token_hash, user_id, created_at, expires_at)
+VALUES
+    ($1, $2, NOW(), NOW() + make_interval(secs => sqlc.arg('ttl_seconds')::float8));
+
+-- name: ConsumePasswordReset :one
+-- Marking the token used in the same statement that checks it keeps it
+-- single-use even when two resets race.
+UPDATE
+    password_resets
+SET
+    used_at = NOW()
+WHERE
+    token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING
+    user_id;
+
+-- name: DeletePasswordResets :exec
+DELETE FROM
+    password_resets
+WHERE
+    user_id = $1;
@@ -0,0 +1,77 @@
+-- name: RechirpChirp :execrows
+-- Counts the same way as LikeChirp.
+WITH inserted AS (
+    INSERT INTO
+        rechirps (user_id, chirp_id, created_at)
+    VALUES
+        ($1, $2, NOW())
+    ON CONFLICT DO NOTHING
+    RETURNING
+        chirp_id
+)
+UPDATE
+    chirps
+SET
+    rechirp_count = rechirp_count + 1
+WHERE
+    id IN (
+        SELECT
+            chirp_id
+        FROM
+            inserted
+    );
+
+-- name: UnrechirpChirp :execrows
+WITH deleted AS (
+    DELETE FROM
+        rechirps
+    WHERE
+        user_id = $1
+        AND chirp_id = $2
+    RETURNING
+        chirp_id
+)
+UPDATE
+    chirps
+SET
+    rechirp_count = rechirp_count - 1
+WHERE
+    id IN (
+        SELECT
+            chirp_id
+        FROM
+            deleted
+    );
+
+-- name: ListChirpRechirps :many
+SELECT
+    users.id,
+    users.handle,
+    rechirps.created_at AS rechirped_at
+FROM
+    rechirps
+    JOIN users ON rechirps.user_id = users.id
+WHERE
+    rechirps.chirp_id = sqlc.arg('chirp_id')
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (rechirps.created_at, users.id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY
+    rechirps.created_at DESC,
+    users.id DESC
+LIMIT
+    sqlc.arg('page_size');
+
+-- name: ListRechirpedChirpIDs :many
+-- Returns which of the given chirps the user has rechirped.
+SELECT
+    chirp_id
+FROM
+    rechirps
+WHERE
+    user_id = sqlc.arg('user_id')
+    AND chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
@@ -0,0 +1,30 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO
+    recovery_codes(id, user_id, code_hash, created_at)
+VALUES
+    (gen_random_uuid(), $1, $2, NOW());
+
+-- name: ListRecoveryCodes :many
+SELECT
+    id,
+    code_hash
+FROM
+    recovery_codes
+WHERE
+    user_id = $1
+    AND used_at IS NULL;
+
+-- name: UseRecoveryCode :execrows
+UPDATE
+    recovery_codes
+SET
+    used_at = NOW()
+WHERE
+    id = $1
+    AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM
+    recovery_codes
+WHERE
+    user_id = $1;
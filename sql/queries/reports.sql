@@ -0,0 +1,101 @@
+-- name: CreateReport :one
+INSERT INTO
+    chirp_reports (
+        id,
+        chirp_id,
+        reporter_id,
+        reason,
+        comment,
+        created_at
+    )
+VALUES
+    (
+        gen_random_uuid(),
+        sqlc.arg('chirp_id'),
+        sqlc.arg('reporter_id'),
+        sqlc.arg('reason'),
+        sqlc.arg('comment'),
+        NOW()
+    )
+RETURNING
+    *;
+
+-- name: ListModerationQueue :many
+-- Chirps with open reports or moderation flags, oldest first. A chirp is
+-- queued from the first time it was reported or flagged.
+WITH pending AS (
+    SELECT
+        chirp_id,
+        created_at,
+        reason,
+        NULL::text AS rule
+    FROM
+        chirp_reports
+    WHERE
+        resolved_at IS NULL
+    UNION ALL
+    SELECT
+        chirp_id,
+        created_at,
+        NULL::text,
+        rule
+    FROM
+        chirp_flags
+)
+SELECT
+    chirps.*,
+    MIN(pending.created_at)::timestamp AS queued_at,
+    COUNT(pending.reason) AS report_count,
+    array_remove(array_agg(DISTINCT pending.reason), NULL)::text [] AS reasons,
+    array_remove(array_agg(DISTINCT pending.rule), NULL)::text [] AS rules
+FROM
+    chirps
+    JOIN pending ON pending.chirp_id = chirps.id
+WHERE
+    chirps.deleted_at IS NULL
+GROUP BY
+    chirps.id
+HAVING
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (MIN(pending.created_at), chirps.id) > (
+        sqlc.narg('cursor_created_at')::timestamp,
+        sqlc.narg('cursor_id')::uuid
+    )
+ORDER BY
+    queued_at,
+    chirps.id
+LIMIT
+    sqlc.arg('page_size');
+
+-- name: IsChirpQueued :one
+-- A chirp is in the moderation queue while it has open reports or flags.
+SELECT
+    (
+        EXISTS (
+            SELECT
+                1
+            FROM
+                chirp_reports
+            WHERE
+                chirp_id = $1
+                AND resolved_at IS NULL
+        )
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                chirp_flags
+            WHERE
+                chirp_id = $1
+        )
+    )::boolean AS queued;
+
+-- name: ResolveChirpReports :execrows
+UPDATE
+    chirp_reports
+SET
+    resolved_at = NOW(),
+    resolution = sqlc.arg('resolution')::text
+WHERE
+    chirp_id = sqlc.arg('chirp_id')
+    AND resolved_at IS NULL;
@@ -0,0 +1,63 @@
+-- name: SearchChirps :many
+-- query is in websearch_to_tsquery syntax; an empty query matches every
+-- chirp so the operators can be used on their own. Snippets are built from
+-- the HTML-escaped body so the <mark> tags are the only markup in them.
+WITH matches AS (
+    SELECT
+        chirps.*,
+        ts_rank(
+            chirps.search,
+            websearch_to_tsquery('english', sqlc.arg('query'))
+        ) AS rank
+    FROM
+        chirps
+    WHERE
+        chirps.deleted_at IS NULL
+        AND chirps.hidden_at IS NULL
+        AND (
+            sqlc.arg('query')::text = ''
+            OR chirps.search @@ websearch_to_tsquery('english', sqlc.arg('query'))
+        )
+        AND (
+            sqlc.narg('from_handle')::text IS NULL
+            OR chirps.user_id = (
+                SELECT
+                    id
+                FROM
+                    users
+                WHERE
+                    handle = sqlc.narg('from_handle')
+            )
+        )
+        AND (
+            sqlc.narg('since')::timestamp IS NULL
+            OR chirps.created_at >= sqlc.narg('since')
+        )
+        AND (
+            sqlc.narg('until')::timestamp IS NULL
+            OR chirps.created_at < sqlc.narg('until')
+        )
+)
+SELECT
+    matches.*,
+    ts_headline(
+        'english',
+        replace(replace(replace(matches.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        websearch_to_tsquery('english', sqlc.arg('query')),
+        'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'
+    ) AS snippet
+FROM
+    matches
+WHERE
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (matches.rank, matches.created_at, matches.id) < (
+        sqlc.narg('cursor_rank')::real,
+        sqlc.narg('cursor_created_at')::timestamp,
+        sqlc.narg('cursor_id')::uuid
+    )
+ORDER BY
+    matches.rank DESC,
+    matches.created_at DESC,
+    matches.id DESC
+LIMIT
+    sqlc.arg('page_size');
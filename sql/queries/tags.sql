@@ -0,0 +1,71 @@
+-- name: SetChirpTags :exec
+-- Replaces the chirp's tags. Tags it already had keep their created_at so
+-- editing a chirp doesn't push them back up the trending list.
+WITH removed AS (
+    DELETE FROM
+        chirp_tags
+    WHERE
+        chirp_id = sqlc.arg('chirp_id')
+        AND tag <> ALL(sqlc.arg('tags')::text[])
+)
+INSERT INTO
+    chirp_tags (chirp_id, tag, created_at)
+SELECT
+    sqlc.arg('chirp_id'),
+    unnest(sqlc.arg('tags')::text[]),
+    NOW()
+ON CONFLICT DO NOTHING;
+
+-- name: ListTagChirps :many
+SELECT
+    chirps.*
+FROM
+    chirps
+    JOIN chirp_tags ON chirp_tags.chirp_id = chirps.id
+WHERE
+    chirp_tags.tag = sqlc.arg('tag')
+    AND chirps.deleted_at IS NULL
+    AND chirps.hidden_at IS NULL
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (chirps.created_at, chirps.id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY
+    chirps.created_at DESC,
+    chirps.id DESC
+LIMIT
+    sqlc.arg('page_size');
+
+-- name: ListTrendingTags :many
+-- Ranks the tags used in the last window_hours. Each use is worth 1 when it
+-- happens and halves every half_life_seconds after that.
+SELECT
+    chirp_tags.tag,
+    COUNT(*) AS uses,
+    SUM(
+        POWER(
+            0.5,
+            EXTRACT(
+                EPOCH
+                FROM
+                    NOW() - chirp_tags.created_at
+            )::float8 / sqlc.arg('half_life_seconds')::float8
+        )
+    )::float8 AS score
+FROM
+    chirp_tags
+    JOIN chirps ON chirps.id = chirp_tags.chirp_id
+WHERE
+    chirp_tags.created_at > NOW() - make_interval(hours => sqlc.arg('window_hours')::int)
+    AND chirps.deleted_at IS NULL
+    AND chirps.hidden_at IS NULL
+GROUP BY
+    chirp_tags.tag
+ORDER BY
+    score DESC,
+    chirp_tags.tag
+LIMIT
+    sqlc.arg('row_limit');
@@ -5,18 +5,26 @@ INSERT INTO
         created_at,
         updated_at,
         user_id,
-        expires_at
+        expires_at,
+        family_id,
+        user_agent,
+        ip,
+        device_name,
+        last_used_at
     )
 VALUES
-    ($1, NOW(), NOW(), $2, $3)
+    ($1, NOW(), NOW(), $2, $3, $4, $5, $6, $7, NOW())
 RETURNING
     *;
 
 -- name: GetToken :one
 SELECT
     token,
+    user_id,
+    family_id,
     expires_at,
-    revoked_at
+    revoked_at,
+    device_name
 FROM
     refresh_tokens
 WHERE
@@ -39,3 +47,82 @@ SET
     updated_at = NOW()
 WHERE
     token = $1;
+
+-- name: RotateToken :execrows
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW(),
+    replaced_by = $2
+WHERE
+    token = $1
+    AND revoked_at IS NULL;
+
+-- name: RevokeTokenFamily :exec
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = $1
+    AND revoked_at IS NULL;
+
+-- name: RevokeUserTokens :exec
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND revoked_at IS NULL;
+
+-- name: ListSessions :many
+-- Each live session has exactly one unrevoked token, the latest rotation.
+SELECT
+    t.family_id,
+    t.device_name,
+    t.user_agent,
+    t.ip,
+    t.last_used_at,
+    (
+        SELECT
+            MIN(f.created_at)
+        FROM
+            refresh_tokens f
+        WHERE
+            f.family_id = t.family_id
+    )::timestamp AS signed_in_at
+FROM
+    refresh_tokens t
+WHERE
+    t.user_id = $1
+    AND t.revoked_at IS NULL
+    AND t.expires_at > NOW()
+ORDER BY
+    t.last_used_at DESC,
+    t.family_id;
+
+-- name: RevokeSession :execrows
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND family_id = $2
+    AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :execrows
+UPDATE
+    refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND family_id <> $2
+    AND revoked_at IS NULL;
@@ -5,15 +5,17 @@ INSERT INTO
         email,
         created_at,
         updated_at,
-        hashed_password
+        hashed_password,
+        handle
     )
 VALUES
-    (gen_random_uuid(), $1, NOW(), NOW(), $2)
+    (gen_random_uuid(), $1, NOW(), NOW(), $2, $3)
 RETURNING
     id,
     email,
     created_at,
-    updated_at;
+    updated_at,
+    is_chirpy_red;
 
 -- name: DeleteUsers :exec
 DELETE FROM
@@ -35,17 +37,110 @@ FROM
 WHERE
     id = $1;
 
--- name: UpdateUserEmailAndPassword :one
+-- name: UpdateUserAccount :one
+-- The email itself only changes once the pending address is verified.
 UPDATE
     users
 SET
-    email = $2,
-    hashed_password = $3,
+    hashed_password = sqlc.arg('hashed_password'),
+    handle = COALESCE(sqlc.narg('handle'), handle),
+    pending_email = sqlc.narg('pending_email'),
     updated_at = NOW()
 WHERE
-    id = $1
+    id = sqlc.arg('id')
 RETURNING
-    id,
-    email,
-    created_at,
-    updated_at;
+    *;
+
+-- name: SetUserChirpyRed :execrows
+UPDATE
+    users
+SET
+    is_chirpy_red = $2,
+    updated_at = NOW()
+WHERE
+    id = $1;
+
+-- name: SuspendUser :execrows
+UPDATE
+    users
+SET
+    suspended_at = COALESCE(suspended_at, NOW()),
+    updated_at = NOW()
+WHERE
+    id = $1;
+
+-- name: SetUserRole :execrows
+UPDATE
+    users
+SET
+    role = $2,
+    updated_at = NOW()
+WHERE
+    email = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE
+    users
+SET
+    hashed_password = $2,
+    updated_at = NOW()
+WHERE
+    id = $1;
+
+-- name: VerifyUserEmail :one
+-- Confirms either the current address or the pending one. A token for an
+-- address the user has since replaced matches no row.
+UPDATE
+    users
+SET
+    email = sqlc.arg('email'),
+    email_verified_at = NOW(),
+    pending_email = CASE
+        WHEN pending_email = sqlc.arg('email') THEN NULL
+        ELSE pending_email
+    END,
+    updated_at = NOW()
+WHERE
+    id = sqlc.arg('id')
+    AND (
+        email = sqlc.arg('email')
+        OR pending_email = sqlc.arg('email')
+    )
+RETURNING
+    *;
+
+-- name: SetUserTOTPSecret :execrows
+UPDATE
+    users
+SET
+    totp_secret = $2,
+    updated_at = NOW()
+WHERE
+    id = $1
+    AND totp_enabled_at IS NULL;
+
+-- name: EnableUserTOTP :execrows
+UPDATE
+    users
+SET
+    totp_enabled_at = NOW(),
+    totp_last_counter = $2,
+    updated_at = NOW()
+WHERE
+    id = $1
+    AND totp_secret IS NOT NULL
+    AND totp_enabled_at IS NULL;
+
+-- name: UseTOTPCounter :execrows
+-- Only moves forward, so two logins racing with the same code can't both
+-- succeed.
+UPDATE
+    users
+SET
+    totp_last_counter = $2
+WHERE
+    id = $1
+    AND (
+        totp_last_counter IS NULL
+        OR totp_last_counter < $2
+    );
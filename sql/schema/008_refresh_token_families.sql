@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE
+    refresh_tokens
+ADD
+    COLUMN family_id UUID DEFAULT gen_random_uuid() NOT NULL;
+
+ALTER TABLE
+    refresh_tokens
+ADD
+    COLUMN replaced_by TEXT;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_family_id_idx;
+
+ALTER TABLE
+    refresh_tokens DROP COLUMN replaced_by;
+
+ALTER TABLE
+    refresh_tokens DROP COLUMN family_id;
@@ -0,0 +1,43 @@
+-- +goose Up
+CREATE TABLE likes (
+    user_id UUID NOT NULL,
+    chirp_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
+
+CREATE INDEX likes_chirp_id_created_at_idx ON likes (chirp_id, created_at);
+
+CREATE TABLE rechirps (
+    user_id UUID NOT NULL,
+    chirp_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
+
+CREATE INDEX rechirps_chirp_id_created_at_idx ON rechirps (chirp_id, created_at);
+
+ALTER TABLE
+    chirps
+ADD
+    COLUMN like_count INTEGER DEFAULT 0 NOT NULL;
+
+ALTER TABLE
+    chirps
+ADD
+    COLUMN rechirp_count INTEGER DEFAULT 0 NOT NULL;
+
+-- +goose Down
+ALTER TABLE
+    chirps DROP COLUMN rechirp_count;
+
+ALTER TABLE
+    chirps DROP COLUMN like_count;
+
+DROP TABLE rechirps;
+
+DROP TABLE likes;
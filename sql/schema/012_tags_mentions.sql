@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE
+    users
+ADD
+    COLUMN handle TEXT UNIQUE;
+
+CREATE TABLE chirp_tags (
+    chirp_id UUID NOT NULL,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, tag),
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_tags_tag_idx ON chirp_tags (tag);
+
+CREATE INDEX chirp_tags_created_at_idx ON chirp_tags (created_at);
+
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id),
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions (user_id);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
+
+DROP TABLE chirp_tags;
+
+ALTER TABLE
+    users DROP COLUMN handle;
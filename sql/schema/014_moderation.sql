@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE moderation_rules (
+    id UUID PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('word', 'regex', 'domain', 'max_mentions')),
+    action TEXT NOT NULL CHECK (action IN ('mask', 'flag', 'reject')),
+    value TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (kind, value)
+);
+
+CREATE TABLE chirp_flags (
+    chirp_id UUID NOT NULL,
+    rule TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, rule),
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_flags_created_at_idx ON chirp_flags (created_at);
+
+-- +goose Down
+DROP TABLE chirp_flags;
+
+DROP TABLE moderation_rules;
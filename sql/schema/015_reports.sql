@@ -0,0 +1,48 @@
+-- +goose Up
+ALTER TABLE
+    chirps
+ADD
+    COLUMN hidden_at TIMESTAMP;
+
+ALTER TABLE
+    users
+ADD
+    COLUMN suspended_at TIMESTAMP;
+
+CREATE TABLE chirp_reports (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL,
+    reporter_id UUID NOT NULL,
+    reason TEXT NOT NULL CHECK (
+        reason IN (
+            'spam',
+            'harassment',
+            'hate',
+            'violence',
+            'misinformation',
+            'other'
+        )
+    ),
+    comment TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    resolution TEXT CHECK (
+        resolution IN ('dismiss', 'hide', 'delete', 'suspend')
+    ),
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- A user can report a chirp again once their earlier report is resolved.
+CREATE UNIQUE INDEX chirp_reports_open_key ON chirp_reports (chirp_id, reporter_id)
+WHERE
+    resolved_at IS NULL;
+
+-- +goose Down
+DROP TABLE chirp_reports;
+
+ALTER TABLE
+    users DROP COLUMN suspended_at;
+
+ALTER TABLE
+    chirps DROP COLUMN hidden_at;
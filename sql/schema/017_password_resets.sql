@@ -0,0 +1,14 @@
+-- +goose Up
+-- Only a hash of each reset token is stored, so a leaked table can't be used
+-- to take over accounts.
+CREATE TABLE password_resets(
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE password_resets;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- Accounts created before verification existed start out unverified; they
+-- can ask for a new link.
+ALTER TABLE
+    users
+ADD
+    COLUMN email_verified_at TIMESTAMP,
+ADD
+    COLUMN pending_email TEXT;
+
+-- email is the address the token confirms: the account's own address after
+-- signup, or the pending one after an email change.
+CREATE TABLE email_verifications(
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE email_verifications;
+
+ALTER TABLE
+    users DROP COLUMN pending_email,
+    DROP COLUMN email_verified_at;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- totp_secret is set by setup and only takes effect once totp_enabled_at is
+-- set. totp_last_counter is the time step of the last accepted code, so a
+-- code can't be replayed.
+ALTER TABLE
+    users
+ADD
+    COLUMN totp_secret TEXT,
+ADD
+    COLUMN totp_enabled_at TIMESTAMP,
+ADD
+    COLUMN totp_last_counter BIGINT;
+
+CREATE TABLE recovery_codes(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+
+ALTER TABLE
+    users DROP COLUMN totp_last_counter,
+    DROP COLUMN totp_enabled_at,
+    DROP COLUMN totp_secret;
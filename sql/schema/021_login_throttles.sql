@@ -0,0 +1,12 @@
+-- +goose Up
+-- Failed logins are counted per key, either an account's email or a client
+-- address, so unknown emails lock out exactly like registered ones.
+CREATE TABLE login_throttles(
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    locked_until TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
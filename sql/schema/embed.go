@@ -0,0 +1,8 @@
+// Package schema embeds the goose migrations so the chirpy binary can apply
+// them without the goose CLI.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/events"
+	"github.com/google/uuid"
+)
+
+const (
+	streamReplaySize  = 256
+	streamHeartbeat   = 15 * time.Second
+	streamRetryMillis = 3000
+)
+
+type chirpDeletedEvent struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// publishChirpEvent broadcasts a committed chirp change to stream
+// subscribers.
+func (cfg *apiConfig) publishChirpEvent(eventType string, authorID uuid.UUID, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("json marshal failed", "err", err)
+		return
+	}
+
+	cfg.events.Publish(eventType, authorID, data)
+}
+
+func (cfg *apiConfig) stream_chirpsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var authorID uuid.NullUUID
+	if a := r.URL.Query().Get("author_id"); a != "" {
+		id, err := uuid.Parse(a)
+		if err != nil {
+			requestLogger(r).Info("transforming author uuid", "err", err)
+			respondWithError(w, errInvalidQuery.withDetail("Invalid author_id"))
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	var lastEventID uint64
+	if l := r.Header.Get("Last-Event-ID"); l != "" {
+		id, err := strconv.ParseUint(l, 10, 64)
+		if err != nil {
+			requestLogger(r).Info("ignoring malformed Last-Event-ID", "last_event_id", l, "err", err)
+		}
+		lastEventID = id
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout is meant for regular requests; a stream
+	// stays open until the client leaves or the server shuts down.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		requestLogger(r).Warn("clearing write deadline", "err", err)
+	}
+
+	sub, missed := cfg.events.Subscribe(lastEventID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+
+	write := func(ev events.Event) error {
+		if authorID.Valid && ev.AuthorID != authorID.UUID {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+		return err
+	}
+
+	for _, ev := range missed {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		requestLogger(r).Warn("flushing event stream", "err", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := write(ev); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/entities"
+	"github.com/google/uuid"
+)
+
+const (
+	// trendingWindow is how far back tag uses are counted.
+	trendingWindow = 24 * time.Hour
+	// trendingHalfLife is how long it takes a use to lose half its weight.
+	trendingHalfLife = 2 * time.Hour
+
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 50
+)
+
+type TrendingTagResponse struct {
+	Tag   string  `json:"tag"`
+	Uses  int64   `json:"uses"`
+	Score float64 `json:"score"`
+}
+
+// saveChirpEntities indexes the chirp's hashtags and mentions so it can be
+// found by tag and by the users it mentions.
+func (cfg *apiConfig) saveChirpEntities(ctx context.Context, chirp database.Chirp) error {
+	found := entities.Parse(chirp.Body)
+
+	err := cfg.queries.SetChirpTags(ctx, database.SetChirpTagsParams{
+		ChirpID: chirp.ID,
+		Tags:    entities.Texts(found, entities.Hashtag),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.queries.SetChirpMentions(ctx, database.SetChirpMentionsParams{
+		Handles: entities.Texts(found, entities.Mention),
+		ChirpID: chirp.ID,
+	})
+}
+
+func (cfg *apiConfig) get_tag_chirpsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	viewer, ok := cfg.viewer(w, r)
+	if !ok {
+		return
+	}
+
+	tag, ok := entities.NormalizeTag(r.PathValue("tag"))
+	if !ok {
+		respondWithError(w, errNotFound.withDetail("Tag was not found"))
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	chirps, err := cfg.queries.ListTagChirps(r.Context(), database.ListTagChirpsParams{
+		Tag:             tag,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("listing tag chirps", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	res := chirpsToResponse(chirps)
+	if err := cfg.setViewerState(r.Context(), viewer, chirpRefs(res)...); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	if len(chirps) > 0 {
+		last := chirps[len(chirps)-1]
+		setNextLink(w, r, page, len(chirps), pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// get_trending_tagsEndpoint ranks the tags used in the last trendingWindow.
+// Recent uses count for more than old ones, so a burst of activity trends
+// ahead of a tag that has been steadily used all day.
+func (cfg *apiConfig) get_trending_tagsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	limit := defaultTrendingLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			respondWithError(w, errInvalidQuery.withDetail("limit must be a positive integer"))
+			return
+		}
+		limit = min(n, maxTrendingLimit)
+	}
+
+	rows, err := cfg.queries.ListTrendingTags(r.Context(), database.ListTrendingTagsParams{
+		HalfLifeSeconds: trendingHalfLife.Seconds(),
+		WindowHours:     int32(trendingWindow.Hours()),
+		RowLimit:        int32(limit),
+	})
+	if err != nil {
+		requestLogger(r).Error("listing trending tags", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	tags := make([]TrendingTagResponse, 0, len(rows))
+	for _, row := range rows {
+		tags = append(tags, TrendingTagResponse(row))
+	}
+
+	respondWithJSON(w, http.StatusOK, tags)
+}
+
+func (cfg *apiConfig) get_mentionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	chirps, err := cfg.queries.ListMentions(r.Context(), database.ListMentionsParams{
+		UserID:          user_id,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("listing mentions", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	res := chirpsToResponse(chirps)
+	if err := cfg.setViewerState(r.Context(), uuid.NullUUID{UUID: user_id, Valid: true}, chirpRefs(res)...); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	if len(chirps) > 0 {
+		last := chirps[len(chirps)-1]
+		setNextLink(w, r, page, len(chirps), pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
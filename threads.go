@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type ThreadReplyResponse struct {
+	ChirpResponse
+	Depth int32 `json:"depth"`
+}
+
+// ThreadResponse is a chirp with its conversation. Ancestors run from the
+// thread root down to the chirp's parent. Replies are every chirp below it
+// in the order they were posted; build the tree from in_reply_to.
+type ThreadResponse struct {
+	Ancestors []ChirpResponse       `json:"ancestors"`
+	Chirp     ChirpResponse         `json:"chirp"`
+	Replies   []ThreadReplyResponse `json:"replies"`
+}
+
+func (cfg *apiConfig) get_threadEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	viewer, ok := cfg.viewer(w, r)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		requestLogger(r).Info("transforming uuid", "err", err)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		requestLogger(r).Info("parsing page request", "err", err)
+		respondWithError(w, errInvalidQuery.withDetail(err.Error()))
+		return
+	}
+
+	chirp, err := cfg.queries.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		requestLogger(r).Info("getting chirp", "err", err)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	if !cfg.canView(r, chirp) {
+		requestLogger(r).Info("chirp is hidden", "chirp_id", chirp.ID)
+		respondWithError(w, errChirpNotFound)
+		return
+	}
+
+	ancestors, err := cfg.queries.ListChirpAncestors(r.Context(), chirp.ID)
+	if err != nil {
+		requestLogger(r).Error("listing chirp ancestors", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	// Hidden chirps drop out of the thread for callers who can't see them.
+	visible := make([]database.Chirp, 0, len(ancestors))
+	for _, a := range ancestors {
+		if cfg.canView(r, a) {
+			visible = append(visible, a)
+		}
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	rows, err := cfg.queries.ListChirpReplies(r.Context(), database.ListChirpRepliesParams{
+		ChirpID:         chirp.ID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        page.Limit,
+	})
+	if err != nil {
+		requestLogger(r).Error("listing chirp replies", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	replies := make([]ThreadReplyResponse, 0, len(rows))
+	for _, row := range rows {
+		reply := database.Chirp{
+			ID:            row.ID,
+			Body:          row.Body,
+			UserID:        row.UserID,
+			CreatedAt:     row.CreatedAt,
+			UpdatedAt:     row.UpdatedAt,
+			RevisionCount: row.RevisionCount,
+			InReplyTo:     row.InReplyTo,
+			ReplyCount:    row.ReplyCount,
+			DeletedAt:     row.DeletedAt,
+			LikeCount:     row.LikeCount,
+			RechirpCount:  row.RechirpCount,
+			HiddenAt:      row.HiddenAt,
+		}
+		if !cfg.canView(r, reply) {
+			continue
+		}
+		replies = append(replies, ThreadReplyResponse{
+			ChirpResponse: chirpToResponse(reply),
+			Depth:         row.Depth,
+		})
+	}
+
+	// The cursor follows the rows read, not the replies kept, so a page of
+	// hidden replies doesn't end the thread early.
+	if len(rows) > 0 {
+		last := rows[len(rows)-1]
+		setNextLink(w, r, page, len(rows), pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	res := ThreadResponse{
+		Ancestors: chirpsToResponse(visible),
+		Chirp:     chirpToResponse(chirp),
+		Replies:   replies,
+	}
+
+	refs := append(chirpRefs(res.Ancestors), &res.Chirp)
+	for i := range res.Replies {
+		refs = append(refs, &res.Replies[i].ChirpResponse)
+	}
+	if err := cfg.setViewerState(r.Context(), viewer, refs...); err != nil {
+		requestLogger(r).Error("getting viewer state", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// mfaTokenTTL is how long a user has to enter their code after the
+	// password was accepted.
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+	totpIssuer        = "Chirpy"
+)
+
+// MFAChallengeResponse replaces the tokens in the login response of users
+// with two-factor authentication. The MFA token goes to POST /api/login/2fa.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+func (cfg *apiConfig) challengeSecondFactor(w http.ResponseWriter, r *http.Request, user database.User) {
+	token, err := auth.MakeJWT(user.ID, cfg.secret, mfaTokenTTL, auth.WithScope(auth.ScopeMFAPending))
+	if err != nil {
+		requestLogger(r).Error("making mfa token", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	requestLogger(r).Info("password accepted, second factor required")
+	respondWithJSON(w, http.StatusOK, MFAChallengeResponse{MFARequired: true, MFAToken: token})
+}
+
+// setup_two_factorEndpoint generates a new TOTP secret. It only takes
+// effect once a code from it is confirmed with enable_two_factorEndpoint,
+// so running setup again before that just replaces the secret.
+func (cfg *apiConfig) setup_two_factorEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.queries.GetUserWithId(r.Context(), user_id)
+	if err != nil {
+		requestLogger(r).Error("getting user", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		requestLogger(r).Error("generating totp secret", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	n, err := cfg.queries.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		requestLogger(r).Error("storing totp secret", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, errTwoFactorEnabled)
+		return
+	}
+
+	type response struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// enable_two_factorEndpoint turns two-factor authentication on once the
+// user proves their app generates the right codes. The recovery codes are
+// only ever shown in this response.
+func (cfg *apiConfig) enable_two_factorEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	type payload struct {
+		Code string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var postVal payload
+	if err := decoder.Decode(&postVal); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	user, err := cfg.queries.GetUserWithId(r.Context(), user_id)
+	if err != nil {
+		requestLogger(r).Error("getting user", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, errTwoFactorEnabled)
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, errTwoFactorNotSetUp)
+		return
+	}
+
+	counter, ok := auth.ValidateTOTP(user.TotpSecret.String, postVal.Code, time.Now())
+	if !ok {
+		requestLogger(r).Info("totp code rejected")
+		respondWithError(w, errTwoFactorInvalid)
+		return
+	}
+
+	// The codes are stored before 2FA is switched on so a failure can't
+	// leave the user without a way back in.
+	codes, ok := cfg.replaceRecoveryCodes(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	n, err := cfg.queries.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+		ID:              user.ID,
+		TotpLastCounter: sql.NullInt64{Int64: counter, Valid: true},
+	})
+	if err != nil {
+		requestLogger(r).Error("enabling totp", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, errTwoFactorEnabled)
+		return
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	requestLogger(r).Info("two-factor authentication enabled")
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+// replaceRecoveryCodes generates a fresh set of recovery codes, storing
+// their argon2id hashes in place of the old set. On failure the error
+// response has already been sent.
+func (cfg *apiConfig) replaceRecoveryCodes(w http.ResponseWriter, r *http.Request, user_id uuid.UUID) ([]string, bool) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		requestLogger(r).Error("generating recovery codes", "err", err)
+		respondWithError(w, errInternal)
+		return nil, false
+	}
+
+	if err := cfg.queries.DeleteRecoveryCodes(r.Context(), user_id); err != nil {
+		requestLogger(r).Error("deleting recovery codes", "err", err)
+		respondWithError(w, errInternal)
+		return nil, false
+	}
+
+	for _, code := range codes {
+		hash, err := auth.HashPassword(code)
+		if err != nil {
+			requestLogger(r).Error("hashing recovery code", "err", err)
+			respondWithError(w, errInternal)
+			return nil, false
+		}
+
+		err = cfg.queries.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   user_id,
+			CodeHash: hash,
+		})
+		if err != nil {
+			requestLogger(r).Error("storing recovery code", "err", err)
+			respondWithError(w, errInternal)
+			return nil, false
+		}
+	}
+
+	return codes, true
+}
+
+// login_two_factorEndpoint finishes a login started by loginEndpoint with
+// either a TOTP code or one of the recovery codes.
+func (cfg *apiConfig) login_two_factorEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	type payload struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		DeviceName   string `json:"device_name"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var postVal payload
+	if err := decoder.Decode(&postVal); err != nil {
+		requestLogger(r).Info("decoding request body", "err", err)
+		respondWithError(w, errInvalidJSON)
+		return
+	}
+
+	if (postVal.Code == "") == (postVal.RecoveryCode == "") {
+		respondWithError(w, errValidation.withFields(fieldError{Field: "code", Code: "required", Detail: "Send either code or recovery_code"}))
+		return
+	}
+
+	deviceName, fields := validateDeviceName(postVal.DeviceName)
+	if len(fields) > 0 {
+		respondWithError(w, errValidation.withFields(fields...))
+		return
+	}
+
+	claims, err := auth.ParseScopedJWT(postVal.MFAToken, cfg.secret, auth.ScopeMFAPending)
+	if err != nil {
+		requestLogger(r).Info("validating mfa token", "err", err)
+		respondWithError(w, errTokenInvalid)
+		return
+	}
+	setRequestUser(r, claims.UserID)
+
+	user, err := cfg.queries.GetUserWithId(r.Context(), claims.UserID)
+	if err != nil {
+		requestLogger(r).Info("getting user", "err", err)
+		respondWithError(w, errTokenInvalid)
+		return
+	}
+	if user.SuspendedAt.Valid {
+		respondWithError(w, errAccountSuspended)
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, errTokenInvalid)
+		return
+	}
+
+	// Wrong codes count as failed logins, otherwise a stolen password
+	// would allow guessing codes without limit.
+	if !cfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+
+	var accepted bool
+	if postVal.Code != "" {
+		accepted, err = cfg.useTOTPCode(r, user, postVal.Code)
+	} else {
+		accepted, err = cfg.useRecoveryCode(r, user, postVal.RecoveryCode)
+	}
+	if err != nil {
+		requestLogger(r).Error("checking second factor", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	if !accepted {
+		requestLogger(r).Info("second factor rejected")
+		cfg.recordLoginFailure(r, user.Email)
+		respondWithError(w, errTwoFactorInvalid)
+		return
+	}
+
+	cfg.startSession(w, r, user, deviceName)
+}
+
+// useTOTPCode accepts a code at most once: the code's time step has to be
+// newer than the last one used.
+func (cfg *apiConfig) useTOTPCode(r *http.Request, user database.User, code string) (bool, error) {
+	counter, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	n, err := cfg.queries.UseTOTPCounter(r.Context(), database.UseTOTPCounterParams{
+		ID:              user.ID,
+		TotpLastCounter: sql.NullInt64{Int64: counter, Valid: true},
+	})
+	return n == 1, err
+}
+
+func (cfg *apiConfig) useRecoveryCode(r *http.Request, user database.User, code string) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+
+	stored, err := cfg.queries.ListRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range stored {
+		match, err := auth.CheckPasswordHash(code, s.CodeHash)
+		if err != nil || !match {
+			continue
+		}
+
+		n, err := cfg.queries.UseRecoveryCode(r.Context(), s.ID)
+		if err != nil {
+			return false, err
+		}
+		if n == 1 {
+			requestLogger(r).Info("recovery code used", "remaining", len(stored)-1)
+		}
+		return n == 1, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/arnicfil/go_learn_http_chirpy/internal/auth"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/database"
+	"github.com/arnicfil/go_learn_http_chirpy/internal/mail"
+	"github.com/google/uuid"
+)
+
+const (
+	emailVerificationTTL     = 24 * time.Hour
+	emailVerificationTimeout = time.Minute
+)
+
+const emailVerificationBody = `Please confirm that this is your email address for Chirpy by opening
+this link within 24 hours:
+
+%s
+
+If you didn't ask for this you can ignore this email.
+`
+
+// sendEmailVerification mails a link that confirms email for the user. The
+// address is stored with the token, so a link only ever confirms the
+// address it was sent to.
+func (cfg *apiConfig) sendEmailVerification(ctx context.Context, logger *slog.Logger, userID uuid.UUID, email string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.queries.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		TokenHash:  auth.HashToken(token),
+		UserID:     userID,
+		Email:      email,
+		TtlSeconds: emailVerificationTTL.Seconds(),
+	})
+	if err != nil {
+		return fmt.Errorf("storing verification token: %w", err)
+	}
+
+	link := strings.TrimSuffix(cfg.publicURL, "/") + "/api/users/verify?" + url.Values{"token": {token}}.Encode()
+	err = cfg.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body:    fmt.Sprintf(emailVerificationBody, link),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("email verification sent")
+	return nil
+}
+
+// sendEmailVerificationLater sends the verification mail after the response,
+// for callers that only log a failure anyway.
+func (cfg *apiConfig) sendEmailVerificationLater(r *http.Request, userID uuid.UUID, email string) {
+	logger := requestLogger(r)
+	ctx := context.WithoutCancel(r.Context())
+	cfg.background.Go(func() {
+		ctx, cancel := context.WithTimeout(ctx, emailVerificationTimeout)
+		defer cancel()
+
+		if err := cfg.sendEmailVerification(ctx, logger, userID, email); err != nil {
+			logger.Error("sending email verification", "err", err)
+		}
+	})
+}
+
+// verify_emailEndpoint is where the link in a verification email leads. It
+// marks the address verified and, for an email change, makes the pending
+// address the account's email.
+func (cfg *apiConfig) verify_emailEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithError(w, errVerificationTokenInvalid)
+		return
+	}
+
+	verification, err := cfg.queries.ConsumeEmailVerification(r.Context(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		requestLogger(r).Info("verification token is invalid, expired or used")
+		respondWithError(w, errVerificationTokenInvalid)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("consuming verification token", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+	setRequestUser(r, verification.UserID)
+
+	user, err := cfg.queries.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// The user changed the address again after this link was sent.
+		requestLogger(r).Info("verification for a replaced address")
+		respondWithError(w, errVerificationTokenInvalid)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Info("verifying email", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	requestLogger(r).Info("email verified")
+	respondWithJSON(w, http.StatusOK, userToResponse(user, "", ""))
+}
+
+// resend_verificationEndpoint sends a new link for the pending address, or
+// for the account's email if it isn't verified yet.
+func (cfg *apiConfig) resend_verificationEndpoint(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user_id, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.queries.GetUserWithId(r.Context(), user_id)
+	if err != nil {
+		requestLogger(r).Error("getting user", "err", err)
+		respondWithError(w, databaseError(err))
+		return
+	}
+
+	email := user.Email
+	switch {
+	case user.PendingEmail.Valid:
+		email = user.PendingEmail.String
+	case user.EmailVerifiedAt.Valid:
+		respondWithError(w, errEmailAlreadyVerified)
+		return
+	}
+
+	if err := cfg.sendEmailVerification(r.Context(), requestLogger(r), user.ID, email); err != nil {
+		requestLogger(r).Error("sending email verification", "err", err)
+		respondWithError(w, errInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}